@@ -1,47 +1,213 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/Arjxm/tracer/core/decoder"
 	evm_simulator "github.com/Arjxm/tracer/core/evm-simulator"
 	"github.com/Arjxm/tracer/core/rpc"
+	"github.com/Arjxm/tracer/core/sourcemap"
 	"github.com/Arjxm/tracer/core/tui"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 func main() {
+	txHash := flag.String("tx", "0x0ca14589e6f2512282bfb1b0f49aed1b033e24be3a1c9a8df4327ebbc94aee65", "hash of the transaction to simulate")
+	replay := flag.Bool("replay", false, "replay the transaction at its position in its block")
+	verify := flag.Bool("verify", false, "compare the replay with the receipt, implies -replay")
+	offline := flag.Bool("offline", false, "serve chain state only from the local cache, failing on a miss")
+	noCache := flag.Bool("no-cache", false, "don't read or write the local chain state cache")
+	cacheDir := flag.String("cache-dir", "", "directory of the chain state cache (default ~/.cache/tracer)")
+	callTrace := flag.String("call-trace", "", "write the trace in the callTracer format of geth to this file")
+	flatTrace := flag.String("flat-trace", "", "write the trace in the trace_transaction format of Parity to this file")
+	opcodeTrace := flag.String("opcode-trace", "", "stream every executed opcode as EIP-3155 JSON lines to this file")
+	opcodeMemory := flag.Bool("opcode-memory", false, "capture the memory in the opcode trace")
+	opcodeReturnData := flag.Bool("opcode-return-data", false, "capture the return data in the opcode trace")
+	opcodeNoStack := flag.Bool("opcode-no-stack", false, "don't capture the stack in the opcode trace")
+	opcodeNoStorage := flag.Bool("opcode-no-storage", false, "don't capture the storage in the opcode trace")
+	opcodes := flag.Bool("opcodes", false, "record the opcodes of every frame to step through them in the viewer")
+	sources := flag.String("sources", "", "comma separated compiler artifacts, or directories of them, to step through the Solidity sources, implies -opcodes")
+	sourceRoot := flag.String("source-root", "", "directory the paths of the sources are relative to when the artifacts don't hold them")
+	signatures := flag.String("signatures", "", "comma separated signature lists (text, JSON) or ABIs to import in the signature database")
+	remoteSignatures := flag.Bool("remote-signatures", false, "look up unknown selectors and topics in 4byte.directory and openchain")
+	abis := flag.String("abi", "", "comma separated address=path of the ABIs or compiler artifacts of contracts")
+	abiDir := flag.String("abi-dir", "", "directory of ABIs named after their address, or of deployment artifacts")
+	labels := flag.String("labels", "", "comma separated label files (JSON, CSV of address,name[,symbol,decimals]) naming addresses in the viewer")
+	detectTokens := flag.Bool("detect-tokens", false, "name tokens and Uniswap pools after their symbol() and decimals() on the forked state")
+	flag.Parse()
 
 	rpcClt := rpc.NewClient(1)
+	signatureDB := decoder.NewSignatureDB()
+	if !*noCache {
+		dir := *cacheDir
+		if dir == "" {
+			d, err := rpc.DefaultCacheDir()
+			if err != nil {
+				log.Fatal(err)
+			}
+			dir = d
+		}
+		cache, err := rpc.OpenCache(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cache.Close()
+		rpcClt.Cache = cache
+
+		signatureDB, err = decoder.OpenSignatureDB(filepath.Join(dir, "signatures.txt"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *signatures != "" {
+		for _, path := range strings.Split(*signatures, ",") {
+			if err := signatureDB.ImportFile(path); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	signatureDB.Remote = *remoteSignatures && !*offline
+	if signatureDB.Remote && signatureDB.CachePath == "" {
+		log.Println("-no-cache is set, the signatures fetched remotely are kept for this run only")
+	}
+	rpcClt.Offline = *offline
+	if rpcClt.Offline && rpcClt.Cache == nil {
+		log.Fatal("-offline needs the cache, drop -no-cache")
+	}
+
 	sim, err := evm_simulator.NewSimulator(rpcClt)
 	if err != nil {
 		log.Fatal(err)
 	}
+	sim.ABIs = decoder.NewRegistry()
+	sim.ABIs.Signatures = signatureDB
+	if *abiDir != "" {
+		if err := sim.ABIs.LoadDir(*abiDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *abis != "" {
+		for _, entry := range strings.Split(*abis, ",") {
+			addr, path, ok := strings.Cut(entry, "=")
+			if !ok || !common.IsHexAddress(addr) {
+				log.Fatalf("invalid -abi entry %q, want address=path", entry)
+			}
+			if err := sim.ABIs.LoadFile(common.HexToAddress(addr), path); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	sim.Labels = decoder.NewLabels()
+	sim.DetectTokens = *detectTokens
+	if *labels != "" {
+		for _, path := range strings.Split(*labels, ",") {
+			if err := sim.Labels.LoadFile(path); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	sim.Opcodes = *opcodes || *sources != ""
+	if *sources != "" {
+		sim.Sources = sourcemap.NewSources()
+		sim.Sources.Root = *sourceRoot
+		for _, path := range strings.Split(*sources, ",") {
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if info.IsDir() {
+				err = sim.Sources.LoadDir(path)
+			} else {
+				err = sim.Sources.LoadFile(path)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	var closeTrace func() error
+	if *opcodeTrace != "" {
+		file, err := os.Create(*opcodeTrace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := bufio.NewWriter(file)
+		sim.OpcodeLogger = evm_simulator.NewStructLogger(w, &evm_simulator.StructLoggerConfig{
+			EnableMemory:     *opcodeMemory,
+			DisableStack:     *opcodeNoStack,
+			DisableStorage:   *opcodeNoStorage,
+			EnableReturnData: *opcodeReturnData,
+		})
+		closeTrace = func() error {
+			return errors.Join(sim.OpcodeLogger.Err(), w.Flush(), file.Close())
+		}
+	}
 
 	simulation := evm_simulator.TxSimulationReq{
-		ChainId: 1,
-		TxHash:  "0x0ca14589e6f2512282bfb1b0f49aed1b033e24be3a1c9a8df4327ebbc94aee65",
+		ChainId:       1,
+		TxHash:        *txHash,
+		ReplayInBlock: *replay || *verify,
+		VerifyReceipt: *verify,
 	}
 	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
 
 	result, err := sim.Simulate(simulation, stateDB, nil)
-	if err != nil {
-		fmt.Println(err)
+	// the opcode trace is complete, it's written out right away as log.Fatal
+	// skips the deferred calls
+	if closeTrace != nil {
+		if err := closeTrace(); err != nil {
+			log.Fatal(err)
+		}
 	}
-
-	var trace tui.Event
-	err = json.Unmarshal(result.Trace, &trace)
 	if err != nil {
-
+		log.Fatal(err)
+	}
+	if result.Err != nil {
+		fmt.Println("execution failed:", result.Err)
+	}
+	if result.Revert != nil {
+		fmt.Println("revert reason:", result.Revert)
+	}
+	if result.Verification != nil {
+		fmt.Println(result.Verification)
+	}
+	if *callTrace != "" {
+		data, err := json.MarshalIndent(result.CallTrace, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*callTrace, data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *flatTrace != "" {
+		data, err := json.MarshalIndent(result.FlatTrace, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*flatTrace, data, 0o644); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	var content string
-	for _, node := range trace {
-		content += tui.DisplayTree(node, 0)
-		content += "\n"
+	var trace tui.Event
+	// numbers are kept as is, values don't fit in a float
+	dec := json.NewDecoder(bytes.NewReader(result.Trace))
+	dec.UseNumber()
+	if err := dec.Decode(&trace); err != nil {
+		log.Fatal(err)
 	}
 
-	tui.Display(content)
+	tui.DisplayTrace(trace)
 }
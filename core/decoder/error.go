@@ -1 +1,102 @@
 package decoder
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	// selectors of Error(string) and Panic(uint256), emitted by require,
+	// revert and the checks of the compiler
+	errorSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// panicReasons describes the panic codes of Solidity.
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to a zero-initialized internal function",
+}
+
+// RevertReason is the decoded output of a reverted call. Name is Error, Panic,
+// the name of a custom error, or empty when the error isn't known.
+type RevertReason struct {
+	Name   string
+	Args   []interface{}
+	Reason string
+}
+
+func (r *RevertReason) String() string {
+	return r.Reason
+}
+
+// DecodeRevert decodes the output of a call to addr that reverted, the custom
+// errors are looked up in registry which may be nil. It returns nil for an
+// empty output, a revert without reason.
+func DecodeRevert(output []byte, addr common.Address, registry *Registry) *RevertReason {
+	if len(output) == 0 {
+		return nil
+	}
+	if len(output) < 4 {
+		return &RevertReason{Reason: fmt.Sprintf("unknown error %s", hexutil.Encode(output))}
+	}
+	selector, data := output[:4], output[4:]
+
+	switch {
+	case bytes.Equal(selector, errorSelector):
+		if reason, err := abi.UnpackRevert(output); err == nil {
+			return &RevertReason{Name: "Error", Args: []interface{}{reason}, Reason: reason}
+		}
+	case bytes.Equal(selector, panicSelector) && len(data) == 32:
+		code := new(big.Int).SetBytes(data)
+		reason, ok := panicReasons[code.Uint64()]
+		if !ok || !code.IsUint64() {
+			reason = "unknown panic"
+		}
+		return &RevertReason{
+			Name:   "Panic",
+			Args:   []interface{}{code},
+			Reason: fmt.Sprintf("panic: %s (0x%x)", reason, code),
+		}
+	}
+
+	if e := registry.ErrorByID(addr, [4]byte(selector)); e != nil {
+		if args, err := e.Inputs.Unpack(data); err == nil {
+			return &RevertReason{Name: e.Name, Args: args, Reason: formatCall(e.Name, args)}
+		}
+	}
+	if registry != nil && registry.Signatures != nil {
+		// errors are hashed like functions, a failing lookup is as good as no
+		// signature
+		signatures, _ := registry.Signatures.FunctionSignatures([4]byte(selector))
+		for _, signature := range signatures {
+			if name, _, args, ok := guessUnpack(signature, data); ok {
+				return &RevertReason{Name: name, Args: args, Reason: formatCall(name, args)}
+			}
+		}
+	}
+	return &RevertReason{Reason: fmt.Sprintf("unknown error %s", hexutil.Encode(output))}
+}
+
+// formatCall renders a decoded call, event or error as name(arg, ...).
+func formatCall(name string, args []interface{}) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = formatValue(arg)
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(values, ", "))
+}
@@ -0,0 +1,67 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDecodeRevert(t *testing.T) {
+	var (
+		token  = common.HexToAddress("0xb2")
+		caller = common.HexToAddress("0xa1")
+	)
+	tokenABI, err := abi.JSON(strings.NewReader(`[{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"owner","type":"address"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry()
+	registry.Register(token, &tokenABI)
+	insufficient := tokenABI.Errors["InsufficientBalance"]
+	args, err := insufficient.Inputs.Pack(common.Big2, caller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := append(insufficient.ID[:4:4], args...)
+
+	tests := []struct {
+		output []byte
+		addr   common.Address
+		name   string
+		reason string
+	}{
+		{
+			output: common.FromHex("0x08c379a0" +
+				"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"6e6f000000000000000000000000000000000000000000000000000000000000"),
+			name:   "Error",
+			reason: "no",
+		},
+		{
+			output: common.FromHex("0x4e487b71" + "0000000000000000000000000000000000000000000000000000000000000011"),
+			name:   "Panic",
+			reason: "panic: arithmetic underflow or overflow (0x11)",
+		},
+		{
+			output: custom,
+			addr:   token,
+			name:   "InsufficientBalance",
+			reason: "InsufficientBalance(2, 0x00000000000000000000000000000000000000A1)",
+		},
+		// bubbled up by a caller without ABI
+		{output: custom, addr: caller, name: "InsufficientBalance", reason: "InsufficientBalance(2, 0x00000000000000000000000000000000000000A1)"},
+		{output: common.FromHex("0xdeadbeef"), reason: "unknown error 0xdeadbeef"},
+	}
+	for i, test := range tests {
+		revert := DecodeRevert(test.output, test.addr, registry)
+		if revert == nil || revert.Name != test.name || revert.Reason != test.reason {
+			t.Errorf("test %d: have %+v, want %s %q", i, revert, test.name, test.reason)
+		}
+	}
+	if revert := DecodeRevert(nil, token, nil); revert != nil {
+		t.Errorf("revert without reason decoded as %+v", revert)
+	}
+}
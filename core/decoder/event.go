@@ -1 +1,169 @@
 package decoder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DecodedEvent is a log decoded with the ABI of its emitter, or with a
+// signature guessed from its first topic when Guessed is set.
+type DecodedEvent struct {
+	Name      string
+	Signature string
+	// Args are in declaration order, indexed or not
+	Args      []Arg
+	Anonymous bool
+	Guessed   bool
+}
+
+// DecodeLog decodes a log emitted by addr, it returns nil when it matches no
+// known event.
+func DecodeLog(addr common.Address, topics []common.Hash, data []byte, registry *Registry) *DecodedEvent {
+	if contractABI := registry.ABI(addr); contractABI != nil {
+		if decoded := decodeWithABI(contractABI, topics, data); decoded != nil {
+			return decoded
+		}
+	}
+	if len(topics) == 0 || registry == nil {
+		return nil
+	}
+	// emitted through a proxy or a library
+	for _, contractABI := range registry.abis {
+		event, err := contractABI.EventByID(topics[0])
+		if err != nil {
+			continue
+		}
+		if decoded := decodeEvent(event, topics[1:], data); decoded != nil {
+			return decoded
+		}
+	}
+
+	if registry.Signatures == nil {
+		return nil
+	}
+	signatures, _ := registry.Signatures.EventSignatures(topics[0])
+	for _, signature := range signatures {
+		if decoded := guessEvent(signature, topics[1:], data); decoded != nil {
+			return decoded
+		}
+	}
+	return nil
+}
+
+func decodeWithABI(contractABI *abi.ABI, topics []common.Hash, data []byte) *DecodedEvent {
+	if len(topics) > 0 {
+		if event, err := contractABI.EventByID(topics[0]); err == nil {
+			return decodeEvent(event, topics[1:], data)
+		}
+	}
+	// an anonymous event has no topic identifying it, the first one matching
+	// the log is taken
+	for _, event := range contractABI.Events {
+		if !event.Anonymous {
+			continue
+		}
+		if decoded := decodeEvent(&event, topics, data); decoded != nil {
+			return decoded
+		}
+	}
+	return nil
+}
+
+// guessEvent decodes a log as signature, the indexed arguments aren't part of
+// the signature so they're taken to be the first ones, as they usually are.
+func guessEvent(signature string, topics []common.Hash, data []byte) *DecodedEvent {
+	name, args, err := parseSignature(signature)
+	if err != nil || len(topics) > len(args) {
+		return nil
+	}
+	for i := range args {
+		args[i].Name = ""
+		args[i].Indexed = i < len(topics)
+	}
+	event := abi.NewEvent(name, name, false, args)
+	decoded := decodeEvent(&event, topics, data)
+	if decoded == nil {
+		return nil
+	}
+	// re-encoding checks the data has the size the guess implies
+	nonIndexed := args.NonIndexed()
+	values, _ := nonIndexed.Unpack(data)
+	if packed, err := nonIndexed.Pack(values...); err != nil || len(packed) != len(data) {
+		return nil
+	}
+	decoded.Signature = signature
+	decoded.Guessed = true
+	return decoded
+}
+
+// decodeEvent decodes the indexed arguments of event from topics, which
+// doesn't hold the event id, and the others from data.
+func decodeEvent(event *abi.Event, topics []common.Hash, data []byte) *DecodedEvent {
+	var indexed int
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed++
+		}
+	}
+	if indexed != len(topics) {
+		return nil
+	}
+	values, err := event.Inputs.NonIndexed().Unpack(data)
+	if err != nil {
+		return nil
+	}
+
+	decoded := &DecodedEvent{
+		Name:      event.RawName,
+		Signature: event.Sig,
+		Args:      make([]Arg, len(event.Inputs)),
+		Anonymous: event.Anonymous,
+	}
+	for i, input := range event.Inputs {
+		arg := Arg{Name: input.Name, Type: input.Type.String(), Indexed: input.Indexed}
+		if !input.Indexed {
+			arg.Value, values = formatValue(values[0]), values[1:]
+		} else {
+			topic := topics[0]
+			topics = topics[1:]
+			if isHashedTopic(input.Type) {
+				// only the hash of a dynamic value is stored in its topic
+				arg.Value, arg.Hashed = topic.Hex(), true
+			} else {
+				value, err := abi.Arguments{{Type: input.Type}}.Unpack(topic[:])
+				if err != nil {
+					return nil
+				}
+				arg.Value = formatValue(value[0])
+			}
+		}
+		decoded.Args[i] = arg
+	}
+	return decoded
+}
+
+func isHashedTopic(typ abi.Type) bool {
+	switch typ.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+	return false
+}
+
+func (e *DecodedEvent) String() string {
+	values := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		value := arg.Value
+		if arg.Hashed {
+			value = fmt.Sprintf("keccak256 %s", arg.Value)
+		}
+		if arg.Name != "" {
+			value = fmt.Sprintf("%s: %s", arg.Name, value)
+		}
+		values[i] = value
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(values, ", "))
+}
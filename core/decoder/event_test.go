@@ -0,0 +1,56 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const eventsABI = `[
+	{"type":"event","name":"Named","anonymous":false,"inputs":[{"name":"label","type":"string","indexed":true},{"name":"owner","type":"address","indexed":true},{"name":"id","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Ping","anonymous":true,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]}
+]`
+
+func TestDecodeLog(t *testing.T) {
+	var (
+		emitter = common.HexToAddress("0xb2")
+		owner   = common.BytesToHash(common.LeftPadBytes([]byte{0xa1}, 32))
+		label   = crypto.Keccak256Hash([]byte("vitalik"))
+		seven   = common.LeftPadBytes([]byte{0x07}, 32)
+	)
+	contractABI, err := abi.JSON(strings.NewReader(eventsABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry()
+	registry.Signatures = NewSignatureDB()
+	registry.Register(emitter, &contractABI)
+
+	named := DecodeLog(emitter, []common.Hash{contractABI.Events["Named"].ID, label, owner}, seven, registry)
+	if named == nil || !named.Args[0].Hashed || named.String() != "Named(label: keccak256 "+label.Hex()+", owner: 0x00000000000000000000000000000000000000A1, id: 7)" {
+		t.Errorf("indexed string: have %+v", named)
+	}
+
+	ping := DecodeLog(emitter, []common.Hash{owner}, seven, registry)
+	if ping == nil || !ping.Anonymous || ping.String() != "Ping(from: 0x00000000000000000000000000000000000000A1, amount: 7)" {
+		t.Errorf("anonymous event: have %+v", ping)
+	}
+
+	// no ABI, Transfer is in the seed
+	transfer := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	guessed := DecodeLog(common.HexToAddress("0xc3"), []common.Hash{transfer, owner, owner}, seven, registry)
+	if guessed == nil || !guessed.Guessed || !guessed.Args[1].Indexed || guessed.Args[2].Indexed || guessed.Args[2].Value != "7" {
+		t.Errorf("guessed event: have %+v", guessed)
+	}
+	// ERC-721 Transfer has its three arguments indexed
+	guessed = DecodeLog(common.HexToAddress("0xc3"), []common.Hash{transfer, owner, owner, common.BytesToHash(seven)}, nil, registry)
+	if guessed == nil || !guessed.Args[2].Indexed || guessed.Args[2].Value != "7" {
+		t.Errorf("guessed event with indexed id: have %+v", guessed)
+	}
+	if decoded := DecodeLog(emitter, []common.Hash{common.HexToHash("0x01")}, nil, registry); decoded != nil {
+		t.Errorf("unknown event decoded as %+v", decoded)
+	}
+}
@@ -1,5 +1,13 @@
 package decoder
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
 type Event []Node
 
 type Node struct {
@@ -9,23 +17,95 @@ type Node struct {
 	OpCodes  []interface{}          `json:"OpCodes"`
 }
 
-//func decode() {
-//	abiFragments, err := ParseContractABI(ABI)
-//	fun := GetFuncFragment(abiFragments)
-//
-//	if err != nil {
-//		fmt.Println("Error parsing contract ABI:", err)
-//		return
-//	}
-//
-//}
-
-//func GetDecodeFunction(abiFragments []ABIFragment, e []interface{}) {
-//	abiFragments, err := ParseContractABI(ABI)
-//	fun := GetFuncFragment(abiFragments)
-//
-//	if err != nil {
-//		fmt.Println("Error parsing contract ABI:", err)
-//		return
-//	}
-//}
+// Arg is a decoded argument or return value, Value is formatted for display.
+type Arg struct {
+	Name  string
+	Type  string
+	Value string
+	// Indexed is set for the arguments of an event stored in a topic, Hashed
+	// when the topic only holds the hash of the value
+	Indexed bool `json:",omitempty"`
+	Hashed  bool `json:",omitempty"`
+	// Label is the name of an address, or an amount of a token with its
+	// decimals and symbol
+	Label string `json:",omitempty"`
+}
+
+// DecodedCall is a call decoded with the ABI of its callee, or with a
+// signature guessed from its selector when Guessed is set.
+type DecodedCall struct {
+	Name      string
+	Signature string
+	Args      []Arg
+	// Returns is empty for a guessed call, the signature of a function
+	// doesn't describe what it returns
+	Returns []Arg
+	Guessed bool
+}
+
+// DecodeCall decodes the input of a call to addr, and its output unless nil.
+// It returns nil when the input matches no known function.
+func DecodeCall(input, output []byte, addr common.Address, registry *Registry) *DecodedCall {
+	if len(input) < 4 {
+		return nil
+	}
+	selector, data := input[:4], input[4:]
+	if contractABI := registry.ABI(addr); contractABI != nil {
+		if method, err := contractABI.MethodById(selector); err == nil {
+			if args, err := method.Inputs.Unpack(data); err == nil {
+				call := &DecodedCall{
+					Name:      method.Name,
+					Signature: method.Sig,
+					Args:      namedArgs(method.Inputs, args),
+				}
+				if output != nil {
+					if returns, err := method.Outputs.Unpack(output); err == nil {
+						call.Returns = namedArgs(method.Outputs, returns)
+					}
+				}
+				return call
+			}
+		}
+	}
+
+	// a proxy or a contract without ABI
+	if registry == nil || registry.Signatures == nil {
+		return nil
+	}
+	signatures, _ := registry.Signatures.FunctionSignatures([4]byte(selector))
+	for _, signature := range signatures {
+		if name, args, values, ok := guessUnpack(signature, data); ok {
+			return &DecodedCall{
+				Name:      name,
+				Signature: signature,
+				Args:      namedArgs(args, values),
+				Guessed:   true,
+			}
+		}
+	}
+	return nil
+}
+
+func namedArgs(arguments abi.Arguments, values []interface{}) []Arg {
+	args := make([]Arg, len(values))
+	for i, value := range values {
+		args[i] = Arg{
+			Name:  arguments[i].Name,
+			Type:  arguments[i].Type.String(),
+			Value: formatValue(value),
+		}
+	}
+	return args
+}
+
+func (c *DecodedCall) String() string {
+	values := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		if arg.Name != "" {
+			values[i] = fmt.Sprintf("%s: %s", arg.Name, arg.Value)
+		} else {
+			values[i] = arg.Value
+		}
+	}
+	return fmt.Sprintf("%s(%s)", c.Name, strings.Join(values, ", "))
+}
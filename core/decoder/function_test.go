@@ -0,0 +1,47 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const erc20Artifact = `{"address": "0x00000000000000000000000000000000000000b2", "abi": [
+	{"type":"function","name":"balanceOf","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"balance","type":"uint256"}]}
+]}`
+
+func TestDecodeCall(t *testing.T) {
+	var (
+		token = common.HexToAddress("0xb2")
+		owner = common.LeftPadBytes([]byte{0xa1}, 32)
+	)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Token.json"), []byte(erc20Artifact), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry()
+	registry.Signatures = NewSignatureDB()
+	if err := registry.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	input := append(common.FromHex("0x70a08231"), owner...)
+	call := DecodeCall(input, common.LeftPadBytes([]byte{0x05}, 32), token, registry)
+	if call == nil || call.Guessed {
+		t.Fatalf("call not decoded with the ABI: %+v", call)
+	}
+	if call.String() != "balanceOf(owner: 0x00000000000000000000000000000000000000A1)" || call.Returns[0] != (Arg{Name: "balance", Type: "uint256", Value: "5"}) {
+		t.Errorf("decoded call: have %s returning %v", call, call.Returns)
+	}
+
+	// no ABI at this address, the selector is in the seed
+	call = DecodeCall(append(common.FromHex("0xa9059cbb"), append(owner, owner...)...), nil, common.HexToAddress("0xc3"), registry)
+	if call == nil || !call.Guessed || call.String() != "transfer(0x00000000000000000000000000000000000000A1, 161)" {
+		t.Errorf("guessed call: have %+v", call)
+	}
+	if call := DecodeCall(common.FromHex("0xdeadbeef"), nil, token, registry); call != nil {
+		t.Errorf("unknown selector decoded as %+v", call)
+	}
+}
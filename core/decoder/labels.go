@@ -0,0 +1,176 @@
+package decoder
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Label names an address, Symbol and Decimals are set for a token, Decimals
+// being nil when they aren't known.
+type Label struct {
+	Name     string
+	Symbol   string `json:",omitempty"`
+	Decimals *uint8 `json:",omitempty"`
+}
+
+// Labels holds the names of known addresses, the ones defined by the user
+// and the ones detected on chain.
+type Labels struct {
+	mu     sync.RWMutex
+	labels map[common.Address]*Label
+}
+
+func NewLabels() *Labels {
+	return &Labels{labels: make(map[common.Address]*Label)}
+}
+
+// Set labels addr, replacing any previous label.
+func (l *Labels) Set(addr common.Address, label *Label) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.labels[addr] = label
+}
+
+// Get returns the label of addr, nil if there is none. It can be called on
+// nil labels.
+func (l *Labels) Get(addr common.Address) *Label {
+	if l == nil {
+		return nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.labels[addr]
+}
+
+// Name returns the name of addr, empty when it has no label.
+func (l *Labels) Name(addr common.Address) string {
+	if label := l.Get(addr); label != nil {
+		return label.Name
+	}
+	return ""
+}
+
+// LoadFile adds the labels of the file at path, a CSV file when its extension
+// is .csv and a JSON file otherwise.
+func (l *Labels) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = l.ImportCSV(file)
+	} else {
+		err = l.ImportJSON(file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	return nil
+}
+
+// ImportCSV adds the labels of rows of address,name[,symbol,decimals], a first
+// row not starting with an address is taken as a header and the rows starting
+// with # are skipped.
+func (l *Labels) ImportCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	for i := 0; ; i++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if i == 0 && !common.IsHexAddress(record[0]) {
+			continue
+		}
+		if len(record) < 2 || !common.IsHexAddress(record[0]) {
+			return fmt.Errorf("invalid row %d, want address,name[,symbol,decimals]", i+1)
+		}
+		label := &Label{Name: record[1]}
+		if len(record) > 2 {
+			label.Symbol = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			decimals, err := strconv.ParseUint(record[3], 10, 8)
+			if err != nil {
+				return fmt.Errorf("invalid decimals on row %d: %w", i+1, err)
+			}
+			label.Decimals = new(uint8)
+			*label.Decimals = uint8(decimals)
+		}
+		l.Set(common.HexToAddress(record[0]), label)
+	}
+}
+
+// ImportJSON adds the labels of an object mapping addresses to a name or to
+// a label, or of a list of labels holding their address.
+func (l *Labels) ImportJSON(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var list []struct {
+		Address common.Address
+		Label
+	}
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, entry := range list {
+			label := entry.Label
+			l.Set(entry.Address, &label)
+		}
+		return nil
+	}
+	var byAddress map[string]json.RawMessage
+	if err := json.Unmarshal(data, &byAddress); err != nil {
+		return fmt.Errorf("not a label list nor a label map: %w", err)
+	}
+	for addr, value := range byAddress {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+		label := new(Label)
+		if err := json.Unmarshal(value, &label.Name); err != nil {
+			if err := json.Unmarshal(value, label); err != nil {
+				return fmt.Errorf("invalid label of %s: %w", addr, err)
+			}
+		}
+		l.Set(common.HexToAddress(addr), label)
+	}
+	return nil
+}
+
+// FormatAmount renders amount, in the smallest unit of a token, as a decimal
+// number of tokens.
+func FormatAmount(amount *big.Int, decimals uint8) string {
+	sign := ""
+	if amount.Sign() < 0 {
+		sign, amount = "-", new(big.Int).Neg(amount)
+	}
+	digits := amount.String()
+	if decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
@@ -0,0 +1,84 @@
+package decoder
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestImportLabels(t *testing.T) {
+	var (
+		usdc   = common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48")
+		router = common.HexToAddress("0xe592427a0aece92de3edee1f18e0157c05861564")
+		weth   = common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+		safe   = common.HexToAddress("0xb1")
+	)
+	labels := NewLabels()
+	err := labels.ImportCSV(strings.NewReader("address,name,symbol,decimals\n" +
+		"# tokens\n" +
+		usdc.Hex() + ",USD Coin,USDC,6\n" +
+		router.Hex() + ",SwapRouter\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = labels.ImportJSON(strings.NewReader(`{
+		"` + weth.Hex() + `": {"Name": "WETH", "Symbol": "WETH", "Decimals": 18},
+		"` + safe.Hex() + `": "Treasury"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := labels.Get(usdc); label == nil || label.Name != "USD Coin" || label.Symbol != "USDC" || label.Decimals == nil || *label.Decimals != 6 {
+		t.Errorf("USDC: have %+v", label)
+	}
+	if label := labels.Get(router); label == nil || label.Name != "SwapRouter" || label.Decimals != nil {
+		t.Errorf("router: have %+v", label)
+	}
+	if label := labels.Get(weth); label == nil || label.Symbol != "WETH" || label.Decimals == nil || *label.Decimals != 18 {
+		t.Errorf("WETH: have %+v", label)
+	}
+	if name := labels.Name(safe); name != "Treasury" {
+		t.Errorf("safe: have %q", name)
+	}
+	if name := labels.Name(common.HexToAddress("0xc1")); name != "" {
+		t.Errorf("unknown address: have %q", name)
+	}
+
+	// a list of labels replaces the previous ones
+	if err := labels.ImportJSON(strings.NewReader(`[{"Address": "` + safe.Hex() + `", "Name": "Multisig"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if name := labels.Name(safe); name != "Multisig" {
+		t.Errorf("relabeled safe: have %q", name)
+	}
+
+	if err := labels.ImportCSV(strings.NewReader(usdc.Hex() + ",USDC,USDC,600\n")); err == nil {
+		t.Errorf("decimals out of range imported")
+	}
+	if err := labels.ImportJSON(strings.NewReader(`{"0x12": "short"}`)); err == nil {
+		t.Errorf("invalid address imported")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{"1500000", 6, "1.5"},
+		{"1000000000000000000", 18, "1"},
+		{"42", 6, "0.000042"},
+		{"0", 6, "0"},
+		{"-2500", 3, "-2.5"},
+		{"123", 0, "123"},
+	}
+	for _, test := range tests {
+		amount, _ := new(big.Int).SetString(test.amount, 10)
+		if have := FormatAmount(amount, test.decimals); have != test.want {
+			t.Errorf("%s with %d decimals: have %s, want %s", test.amount, test.decimals, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Registry holds the known ABI of contracts by address. Signatures, when set,
+// is used to guess what isn't in any of them.
+type Registry struct {
+	Signatures *SignatureDB
+
+	abis map[common.Address]*abi.ABI
+}
+
+func NewRegistry() *Registry {
+	return &Registry{abis: make(map[common.Address]*abi.ABI)}
+}
+
+// Register sets the ABI of the contract at addr, replacing any previous one.
+// Its signatures are also added to the signature database.
+func (r *Registry) Register(addr common.Address, contractABI *abi.ABI) {
+	r.abis[addr] = contractABI
+	if r.Signatures != nil {
+		r.Signatures.ImportABI(contractABI)
+	}
+}
+
+// LoadFile registers for addr the ABI in the file at path, either a bare ABI
+// or a compiler artifact holding it under "abi".
+func (r *Registry) LoadFile(addr common.Address, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	contractABI, _, err := parseArtifact(data)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	r.Register(addr, contractABI)
+	return nil
+}
+
+// LoadDir registers the ABIs of the JSON files found in dir and its
+// subdirectories, the address of a contract being the "address" field of its
+// file, as in hardhat-deploy deployments, or else its name, as in
+// 0x6b175474e89094c44da98b954eedeac495271d0f.json. The other files are
+// skipped.
+func (r *Registry) LoadDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".json") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contractABI, addr, err := parseArtifact(data)
+		if err != nil {
+			return nil
+		}
+		if addr == nil {
+			name := strings.TrimSuffix(entry.Name(), filepath.Ext(path))
+			if !common.IsHexAddress(name) {
+				return nil
+			}
+			a := common.HexToAddress(name)
+			addr = &a
+		}
+		r.Register(*addr, contractABI)
+		return nil
+	})
+}
+
+// parseArtifact reads a bare ABI or an artifact holding one, along with the
+// address of the contract when the artifact has it.
+func parseArtifact(data []byte) (*abi.ABI, *common.Address, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		contractABI, err := abi.JSON(bytes.NewReader(data))
+		return &contractABI, nil, err
+	}
+	var artifact struct {
+		ABI     json.RawMessage `json:"abi"`
+		Address string          `json:"address"`
+	}
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, nil, err
+	}
+	if len(artifact.ABI) == 0 {
+		return nil, nil, fmt.Errorf("no abi")
+	}
+	// explorers serve the ABI as a JSON string
+	var encoded string
+	if err := json.Unmarshal(artifact.ABI, &encoded); err == nil {
+		artifact.ABI = json.RawMessage(encoded)
+	}
+	contractABI, err := abi.JSON(bytes.NewReader(artifact.ABI))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !common.IsHexAddress(artifact.Address) {
+		return &contractABI, nil, nil
+	}
+	addr := common.HexToAddress(artifact.Address)
+	return &contractABI, &addr, nil
+}
+
+// ABI returns the ABI registered for addr, nil if there is none. It can be
+// called on a nil registry.
+func (r *Registry) ABI(addr common.Address) *abi.ABI {
+	if r == nil {
+		return nil
+	}
+	return r.abis[addr]
+}
+
+// ErrorByID looks for the custom error with the given selector, in the ABI of
+// addr first and then in all the others, as a revert may bubble up from a
+// callee.
+func (r *Registry) ErrorByID(addr common.Address, id [4]byte) *abi.Error {
+	if r == nil {
+		return nil
+	}
+	if contractABI := r.abis[addr]; contractABI != nil {
+		if e := errorByID(contractABI, id); e != nil {
+			return e
+		}
+	}
+	for _, contractABI := range r.abis {
+		if e := errorByID(contractABI, id); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func errorByID(contractABI *abi.ABI, id [4]byte) *abi.Error {
+	for _, e := range contractABI.Errors {
+		if [4]byte(e.ID[:4]) == id {
+			return &e
+		}
+	}
+	return nil
+}
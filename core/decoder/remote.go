@@ -0,0 +1,104 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type remoteKind int
+
+const (
+	remoteFunction remoteKind = iota
+	remoteEvent
+)
+
+var remoteClient = &http.Client{Timeout: 10 * time.Second}
+
+// lookupRemote queries 4byte.directory and openchain concurrently for the
+// signatures of a selector or a topic, and returns the first non empty answer.
+func lookupRemote(kind remoteKind, hash string) ([]string, error) {
+	type answer struct {
+		signatures []string
+		err        error
+	}
+	answers := make(chan answer, 2)
+	go func() {
+		signatures, err := lookup4Byte(kind, hash)
+		answers <- answer{signatures, err}
+	}()
+	go func() {
+		signatures, err := lookupOpenchain(kind, hash)
+		answers <- answer{signatures, err}
+	}()
+
+	var lastErr error
+	for i := 0; i < 2; i++ {
+		a := <-answers
+		if a.err != nil {
+			lastErr = a.err
+			continue
+		}
+		if len(a.signatures) > 0 {
+			return a.signatures, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, nil
+}
+
+func lookup4Byte(kind remoteKind, hash string) ([]string, error) {
+	endpoint := "signatures"
+	if kind == remoteEvent {
+		endpoint = "event-signatures"
+	}
+	var body struct {
+		Results []struct {
+			TextSignature string `json:"text_signature"`
+		} `json:"results"`
+	}
+	if err := getJSON(fmt.Sprintf("https://www.4byte.directory/api/v1/%s/?hex_signature=%s", endpoint, hash), &body); err != nil {
+		return nil, err
+	}
+	signatures := make([]string, 0, len(body.Results))
+	for _, result := range body.Results {
+		signatures = append(signatures, result.TextSignature)
+	}
+	return signatures, nil
+}
+
+func lookupOpenchain(kind remoteKind, hash string) ([]string, error) {
+	param := "function"
+	if kind == remoteEvent {
+		param = "event"
+	}
+	var body struct {
+		Result map[string]map[string][]struct {
+			Name string `json:"name"`
+		} `json:"result"`
+	}
+	if err := getJSON(fmt.Sprintf("https://api.openchain.xyz/signature-database/v1/lookup?%s=%s&filter=true", param, hash), &body); err != nil {
+		return nil, err
+	}
+	results := body.Result[param][hash]
+	signatures := make([]string, 0, len(results))
+	for _, result := range results {
+		signatures = append(signatures, result.Name)
+	}
+	return signatures, nil
+}
+
+func getJSON(url string, v interface{}) error {
+	resp, err := remoteClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,352 @@
+package decoder
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+//go:embed signatures.txt
+var seedSignatures string
+
+// SignatureDB resolves function selectors and event topics to the signatures
+// hashing to them. It's filled from an embedded seed and the lists or ABIs
+// imported, the remote databases are only queried when Remote is set.
+type SignatureDB struct {
+	// Remote enables the lookup in 4byte.directory and openchain of the
+	// hashes missing locally, their results are appended to CachePath
+	Remote    bool
+	CachePath string
+
+	mu        sync.RWMutex
+	selectors map[[4]byte][]string
+	topics    map[common.Hash][]string
+	// misses holds the hashes the remote lookup didn't resolve, they aren't
+	// asked again during the session
+	misses map[remoteHash]bool
+}
+
+type remoteHash struct {
+	kind remoteKind
+	hash string
+}
+
+// NewSignatureDB returns a database holding the seed signatures.
+func NewSignatureDB() *SignatureDB {
+	db := &SignatureDB{
+		selectors: make(map[[4]byte][]string),
+		topics:    make(map[common.Hash][]string),
+		misses:    make(map[remoteHash]bool),
+	}
+	// the seed is embedded, it can't fail to be read
+	db.ImportText(strings.NewReader(seedSignatures))
+	return db
+}
+
+// OpenSignatureDB returns a database holding the seed signatures and the ones
+// previously fetched remotely into cachePath, which is created on the first
+// remote lookup if missing.
+func OpenSignatureDB(cachePath string) (*SignatureDB, error) {
+	db := NewSignatureDB()
+	db.CachePath = cachePath
+	if err := db.ImportFile(cachePath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Add indexes signature both as a function and as an event, it must be
+// canonical: no spaces, argument names or aliases such as uint.
+func (db *SignatureDB) Add(signature string) {
+	hash := crypto.Keccak256Hash([]byte(signature))
+	selector := [4]byte(hash[:4])
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !slices.Contains(db.selectors[selector], signature) {
+		db.selectors[selector] = append(db.selectors[selector], signature)
+	}
+	if !slices.Contains(db.topics[hash], signature) {
+		db.topics[hash] = append(db.topics[hash], signature)
+	}
+}
+
+// ImportText adds the signatures of a list holding one per line, the empty
+// lines and the ones starting with # are skipped.
+func (db *SignatureDB) ImportText(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		db.Add(line)
+	}
+	return scanner.Err()
+}
+
+// ImportJSON adds the signatures of a JSON list of signatures, of an object
+// mapping hashes to a signature or a list of them, as exported by signature
+// databases, or of a contract ABI.
+func (db *SignatureDB) ImportJSON(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, signature := range list {
+			db.Add(signature)
+		}
+		return nil
+	}
+	var byHash map[string]json.RawMessage
+	if err := json.Unmarshal(data, &byHash); err == nil {
+		for hash, value := range byHash {
+			var signatures []string
+			if err := json.Unmarshal(value, &signatures); err != nil {
+				var signature string
+				if err := json.Unmarshal(value, &signature); err != nil {
+					return fmt.Errorf("invalid signatures of %s: %w", hash, err)
+				}
+				signatures = []string{signature}
+			}
+			for _, signature := range signatures {
+				db.Add(signature)
+			}
+		}
+		return nil
+	}
+	contractABI, err := abi.JSON(strings.NewReader(string(data)))
+	if err != nil {
+		return fmt.Errorf("not a signature list nor an ABI: %w", err)
+	}
+	db.ImportABI(&contractABI)
+	return nil
+}
+
+// ImportABI adds the functions, events and errors of contractABI.
+func (db *SignatureDB) ImportABI(contractABI *abi.ABI) {
+	for _, method := range contractABI.Methods {
+		db.Add(method.Sig)
+	}
+	for _, event := range contractABI.Events {
+		db.Add(event.Sig)
+	}
+	for _, e := range contractABI.Errors {
+		db.Add(e.Sig)
+	}
+}
+
+// ImportFile adds the signatures of the file at path, a JSON file when its
+// extension is .json and a text list otherwise.
+func (db *SignatureDB) ImportFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = db.ImportJSON(file)
+	} else {
+		err = db.ImportText(file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	return nil
+}
+
+// FunctionSignatures returns the signatures of the functions with selector,
+// several functions may collide.
+func (db *SignatureDB) FunctionSignatures(selector [4]byte) ([]string, error) {
+	db.mu.RLock()
+	signatures := db.selectors[selector]
+	db.mu.RUnlock()
+	if len(signatures) > 0 || !db.Remote {
+		return signatures, nil
+	}
+	return db.fetch(remoteFunction, common.Bytes2Hex(selector[:]))
+}
+
+// EventSignatures returns the signatures of the events with topic as topic0.
+func (db *SignatureDB) EventSignatures(topic common.Hash) ([]string, error) {
+	db.mu.RLock()
+	signatures := db.topics[topic]
+	db.mu.RUnlock()
+	if len(signatures) > 0 || !db.Remote {
+		return signatures, nil
+	}
+	return db.fetch(remoteEvent, common.Bytes2Hex(topic[:]))
+}
+
+// fetch looks hash up remotely and keeps the signatures found, in the
+// database and in its cache file. A hash that isn't resolved, for lack of a
+// signature or on an error, is remembered as a miss for the session.
+func (db *SignatureDB) fetch(kind remoteKind, hash string) ([]string, error) {
+	key := remoteHash{kind, hash}
+	db.mu.RLock()
+	missed := db.misses[key]
+	db.mu.RUnlock()
+	if missed {
+		return nil, nil
+	}
+	signatures, err := lookupRemote(kind, "0x"+hash)
+	if err != nil {
+		db.addMiss(key)
+		return nil, err
+	}
+	// the remote databases hold signatures that don't hash to what was asked
+	verified := signatures[:0]
+	for _, signature := range signatures {
+		sigHash := crypto.Keccak256([]byte(signature))
+		if kind == remoteFunction && common.Bytes2Hex(sigHash[:4]) == hash ||
+			kind == remoteEvent && common.Bytes2Hex(sigHash) == hash {
+			verified = append(verified, signature)
+		}
+	}
+	if len(verified) == 0 {
+		db.addMiss(key)
+		return nil, nil
+	}
+	for _, signature := range verified {
+		db.Add(signature)
+	}
+	if db.CachePath != "" {
+		if err := db.appendToCache(verified); err != nil {
+			return nil, err
+		}
+	}
+	return verified, nil
+}
+
+func (db *SignatureDB) addMiss(key remoteHash) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.misses[key] = true
+}
+
+func (db *SignatureDB) appendToCache(signatures []string) error {
+	if err := os.MkdirAll(filepath.Dir(db.CachePath), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(db.CachePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(strings.Join(signatures, "\n") + "\n")
+	return err
+}
+
+// parseSignature returns the name and the arguments of a canonical signature
+// such as swap((address,uint256)[],bytes).
+func parseSignature(signature string) (string, abi.Arguments, error) {
+	open := strings.IndexByte(signature, '(')
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return "", nil, fmt.Errorf("invalid signature %q", signature)
+	}
+	types, err := splitTypes(signature[open+1 : len(signature)-1])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid signature %q: %w", signature, err)
+	}
+	args := make(abi.Arguments, len(types))
+	for i, t := range types {
+		marshaling, err := argumentMarshaling(fmt.Sprintf("arg%d", i), t)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid signature %q: %w", signature, err)
+		}
+		typ, err := abi.NewType(marshaling.Type, "", marshaling.Components)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid signature %q: %w", signature, err)
+		}
+		args[i] = abi.Argument{Name: marshaling.Name, Type: typ}
+	}
+	return signature[:open], args, nil
+}
+
+// argumentMarshaling describes the type t, a tuple being written as
+// (type,...) followed by its array dimensions.
+func argumentMarshaling(name, t string) (abi.ArgumentMarshaling, error) {
+	if !strings.HasPrefix(t, "(") {
+		return abi.ArgumentMarshaling{Name: name, Type: t}, nil
+	}
+	end := strings.LastIndexByte(t, ')')
+	types, err := splitTypes(t[1:end])
+	if err != nil {
+		return abi.ArgumentMarshaling{}, err
+	}
+	components := make([]abi.ArgumentMarshaling, len(types))
+	for i, component := range types {
+		if components[i], err = argumentMarshaling(fmt.Sprintf("field%d", i), component); err != nil {
+			return abi.ArgumentMarshaling{}, err
+		}
+	}
+	return abi.ArgumentMarshaling{Name: name, Type: "tuple" + t[end+1:], Components: components}, nil
+}
+
+// splitTypes splits a list of types on the commas outside of tuples.
+func splitTypes(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var (
+		types []string
+		depth int
+		start int
+	)
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				types = append(types, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+	return append(types, list[start:]), nil
+}
+
+// guessUnpack decodes data as the arguments of signature, which is a guess
+// made from a hash so it's rejected unless data has the size it implies. The
+// arguments of a signature have no names.
+func guessUnpack(signature string, data []byte) (string, abi.Arguments, []interface{}, bool) {
+	name, args, err := parseSignature(signature)
+	if err != nil {
+		return "", nil, nil, false
+	}
+	values, err := args.Unpack(data)
+	if err != nil {
+		return "", nil, nil, false
+	}
+	// re-encoding checks nothing was left over
+	packed, err := args.Pack(values...)
+	if err != nil || len(packed) != len(data) {
+		return "", nil, nil, false
+	}
+	for i := range args {
+		args[i].Name = ""
+	}
+	return name, args, values, true
+}
@@ -0,0 +1,93 @@
+package decoder
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSignatureDB(t *testing.T) {
+	db := NewSignatureDB()
+	if sigs, _ := db.FunctionSignatures([4]byte(common.FromHex("0xa9059cbb"))); len(sigs) != 1 || sigs[0] != "transfer(address,uint256)" {
+		t.Errorf("seed selector: have %v", sigs)
+	}
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	if sigs, _ := db.EventSignatures(transfer); len(sigs) != 1 || sigs[0] != "Transfer(address,address,uint256)" {
+		t.Errorf("seed topic: have %v", sigs)
+	}
+
+	err := db.ImportJSON(strings.NewReader(`{"0x0f1f3a3a": ["Unauthorized(address)"], "0x12345678": "swap((address,uint256)[],bytes)"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.ImportJSON(strings.NewReader(`[{"type":"function","name":"pause","inputs":[]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sig := range []string{"Unauthorized(address)", "swap((address,uint256)[],bytes)", "pause()"} {
+		hash := crypto.Keccak256Hash([]byte(sig))
+		if sigs, _ := db.FunctionSignatures([4]byte(hash[:4])); len(sigs) != 1 || sigs[0] != sig {
+			t.Errorf("imported %s: have %v", sig, sigs)
+		}
+	}
+
+	name, args, err := parseSignature("swap((address,uint256)[],bytes)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "swap" || len(args) != 2 || args[0].Type.String() != "(address,uint256)[]" {
+		t.Errorf("parsed signature: have %s %v", name, args)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestSignatureDBRemoteMiss(t *testing.T) {
+	var requests atomic.Int32
+	transport := remoteClient.Transport
+	remoteClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	defer func() { remoteClient.Transport = transport }()
+
+	db := NewSignatureDB()
+	db.Remote = true
+	selector := [4]byte{0xde, 0xad, 0xbe, 0xef}
+	for i := 0; i < 3; i++ {
+		if sigs, err := db.FunctionSignatures(selector); err != nil || len(sigs) != 0 {
+			t.Fatalf("unknown selector: have %v, %v", sigs, err)
+		}
+	}
+	if sigs, err := db.EventSignatures(common.Hash{0xde, 0xad}); err != nil || len(sigs) != 0 {
+		t.Fatalf("unknown topic: have %v, %v", sigs, err)
+	}
+	// one request per remote database for the selector, then for the topic
+	if n := requests.Load(); n != 4 {
+		t.Errorf("remote requests: have %d, want 4", n)
+	}
+}
+
+func TestDecodeRevertGuess(t *testing.T) {
+	registry := NewRegistry()
+	registry.Signatures = NewSignatureDB()
+	registry.Signatures.Add("Unauthorized(address)")
+
+	output := append(crypto.Keccak256([]byte("Unauthorized(address)"))[:4], common.LeftPadBytes([]byte{0xa1}, 32)...)
+	revert := DecodeRevert(output, common.Address{}, registry)
+	if revert.Name != "Unauthorized" || revert.Reason != "Unauthorized(0x00000000000000000000000000000000000000A1)" {
+		t.Errorf("guessed error: have %+v", revert)
+	}
+	// the signature doesn't match the size of the arguments
+	revert = DecodeRevert(append(output, make([]byte, 32)...), common.Address{}, registry)
+	if revert.Name != "" {
+		t.Errorf("mismatching signature accepted: %+v", revert)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/ethereum/go-ethereum/accounts/abi"
-	"io"
-	"net/http"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
 type ABIFragment struct {
@@ -36,83 +40,44 @@ func ParseContractABI(abiString string) ([]ABIFragment, error) {
 	return abiFragments, nil
 }
 
-func getFunctionSignature(selector string) (map[string]interface{}, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{}
-
-	// Create channels for results and errors
-	resChan := make(chan map[string]interface{}, 2)
-	errChan := make(chan error, 2)
-
-	// Goroutine for 4byte.directory API
-	go func() {
-		url := fmt.Sprintf("https://www.4byte.directory/api/v1/signatures/?hex_signature=%s", selector)
-		resp, err := client.Get(url)
-		if err == nil {
-			defer resp.Body.Close()
-			var body map[string]interface{}
-			err = json.NewDecoder(resp.Body).Decode(&body)
-			if err == nil {
-				results := body["results"].([]interface{})
-				if len(results) > 0 {
-					resChan <- body
-					return
-				}
-			}
-		}
-		errChan <- err
-	}()
-
-	// Goroutine for Openchain API
-	go func() {
-		url := fmt.Sprintf("https://api.openchain.xyz/signature-database/v1/lookup?function=%s&filter=true", selector)
-		resp, err := client.Get(url)
-		if err == nil {
-			defer func(Body io.ReadCloser) {
-				err := Body.Close()
-				if err != nil {
-
-				}
-			}(resp.Body)
-			var body map[string]interface{}
-			err = json.NewDecoder(resp.Body).Decode(&body)
-			if err == nil {
-				resChan <- body
-				return
-			}
-		}
-		errChan <- err
-	}()
+// formatValue renders a value decoded by the abi package, bytes as hex,
+// strings quoted and tuples as {field: value, ...}.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return hexutil.Encode(v)
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case *big.Int:
+		return v.String()
+	case string:
+		return strconv.Quote(v)
+	}
 
-	// Standardize the response format
-	standardizeResponse := func(resp map[string]interface{}) map[string]interface{} {
-		if results, ok := resp["results"]; ok {
-			return map[string]interface{}{"results": results}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		// fixed size bytes
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
 		}
-		if result, ok := resp["result"]; ok {
-			if function, ok := result.(map[string]interface{})["function"]; ok {
-				if signatures, ok := function.(map[string]interface{})[selector]; ok {
-					return map[string]interface{}{"results": signatures}
-				}
-			}
+		fallthrough
+	case reflect.Slice:
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = formatValue(rv.Index(i).Interface())
 		}
-		return nil
-	}
-
-	// Wait for results or errors from both goroutines
-	for i := 0; i < 2; i++ {
-		select {
-		case res := <-resChan:
-			if standardRes := standardizeResponse(res); standardRes != nil {
-				return standardRes, nil
-			}
-		case err := <-errChan:
-			if err != nil {
-				return nil, err
-			}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Struct:
+		fields := make([]string, rv.NumField())
+		for i := range fields {
+			fields[i] = fmt.Sprintf("%s: %s", rv.Type().Field(i).Name, formatValue(rv.Field(i).Interface()))
 		}
+		return "{" + strings.Join(fields, ", ") + "}"
 	}
-
-	// Return an error if no results are found
-	return nil, fmt.Errorf("no function signature found for selector: %s", selector)
+	return fmt.Sprint(value)
 }
@@ -0,0 +1,283 @@
+package evm_simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// BlockEnv is the block a simulated transaction is executed in.
+type BlockEnv struct {
+	Number      *big.Int
+	Time        uint64
+	GasLimit    uint64
+	Coinbase    common.Address
+	Difficulty  *big.Int
+	BaseFee     *big.Int
+	BlobBaseFee *big.Int
+	Random      *common.Hash
+}
+
+// BlockOverrides replaces fields of the block a simulation is executed in, a
+// nil field keeps the value of the block. BlockHash sets the result of
+// BLOCKHASH for the given numbers, the others are read from the chain up to
+// the block forked from and made up past it.
+type BlockOverrides struct {
+	Number      *big.Int
+	Time        *uint64
+	GasLimit    *uint64
+	Coinbase    *common.Address
+	Difficulty  *big.Int
+	BaseFee     *big.Int
+	BlobBaseFee *big.Int
+	Random      *common.Hash
+	BlockHash   map[uint64]common.Hash
+}
+
+// apply writes the overridden block fields into cfg.
+func (o *BlockOverrides) apply(cfg *runtime.Config) {
+	if o == nil {
+		return
+	}
+	if o.Number != nil {
+		cfg.BlockNumber = o.Number
+	}
+	if o.Time != nil {
+		cfg.Time = *o.Time
+	}
+	if o.GasLimit != nil {
+		cfg.BlockGasLimit = *o.GasLimit
+	}
+	if o.Coinbase != nil {
+		cfg.Coinbase = *o.Coinbase
+	}
+	if o.Difficulty != nil {
+		cfg.Difficulty = o.Difficulty
+	}
+	if o.BaseFee != nil {
+		cfg.BaseFee = o.BaseFee
+	}
+	if o.BlobBaseFee != nil {
+		cfg.BlobBaseFee = o.BlobBaseFee
+	}
+	if o.Random != nil {
+		cfg.Random = o.Random
+	}
+	cfg.BlockHashes = o.BlockHash
+}
+
+// blockEnvFromHeader reads the execution environment from a block returned by
+// eth_getBlockByNumber.
+func blockEnvFromHeader(block map[string]interface{}) (*BlockEnv, error) {
+	number, err := hexBig(block, "number")
+	if err != nil {
+		return nil, err
+	}
+	time, err := hexUint64(block, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+	gasLimit, err := hexUint64(block, "gasLimit")
+	if err != nil {
+		return nil, err
+	}
+	difficulty, err := hexBig(block, "difficulty")
+	if err != nil {
+		return nil, err
+	}
+	miner, _ := block["miner"].(string)
+
+	env := &BlockEnv{
+		Number:     number,
+		Time:       time,
+		GasLimit:   gasLimit,
+		Coinbase:   common.HexToAddress(miner),
+		Difficulty: difficulty,
+	}
+
+	if block["baseFeePerGas"] != nil {
+		if env.BaseFee, err = hexBig(block, "baseFeePerGas"); err != nil {
+			return nil, err
+		}
+	}
+	// after the merge mixHash carries PREVRANDAO
+	if mixHash, ok := block["mixHash"].(string); ok && difficulty.Sign() == 0 {
+		random := common.HexToHash(mixHash)
+		env.Random = &random
+	}
+	if block["excessBlobGas"] != nil {
+		excessBlobGas, err := hexUint64(block, "excessBlobGas")
+		if err != nil {
+			return nil, err
+		}
+		env.BlobBaseFee = eip4844.CalcBlobFee(excessBlobGas)
+	}
+	return env, nil
+}
+
+// simulationFromTx builds the simulation of a transaction returned by
+// eth_getTransactionByHash, BlockNumber is set to the block it was mined in.
+func simulationFromTx(tx map[string]interface{}, chainId uint64) (TxSimulation, error) {
+	from, _ := tx["from"].(string)
+
+	gasLimit, err := hexUint64(tx, "gas")
+	if err != nil {
+		return TxSimulation{}, err
+	}
+	gasPrice, err := hexBig(tx, "gasPrice")
+	if err != nil {
+		return TxSimulation{}, err
+	}
+	value, err := hexBig(tx, "value")
+	if err != nil {
+		return TxSimulation{}, err
+	}
+	input, _ := tx["input"].(string)
+	data, err := hexutil.Decode(input)
+	if err != nil {
+		return TxSimulation{}, fmt.Errorf("invalid input: %w", err)
+	}
+
+	simulation := TxSimulation{
+		From:     common.HexToAddress(from),
+		GasLimit: gasLimit,
+		GasPrice: gasPrice,
+		Value:    value,
+		Input:    data,
+		ChainId:  chainId,
+	}
+	if err := parseTypedTx(tx, &simulation); err != nil {
+		return TxSimulation{}, err
+	}
+	// a contract creation has no recipient
+	if to, ok := tx["to"].(string); ok {
+		addr := common.HexToAddress(to)
+		simulation.To = &addr
+	}
+	if tx["nonce"] != nil {
+		nonce, err := hexUint64(tx, "nonce")
+		if err != nil {
+			return TxSimulation{}, err
+		}
+		simulation.Nonce = &nonce
+	}
+	if hash, ok := tx["hash"].(string); ok {
+		simulation.Hash = common.HexToHash(hash)
+	}
+	if tx["transactionIndex"] != nil {
+		index, err := hexUint64(tx, "transactionIndex")
+		if err != nil {
+			return TxSimulation{}, err
+		}
+		simulation.Index = int(index)
+	}
+	if tx["blockNumber"] != nil {
+		if simulation.BlockNumber, err = hexBig(tx, "blockNumber"); err != nil {
+			return TxSimulation{}, err
+		}
+	}
+	return simulation, nil
+}
+
+// parseTypedTx reads the fields an EIP-2718 typed transaction adds on top of
+// a legacy one.
+func parseTypedTx(tx map[string]interface{}, simulation *TxSimulation) error {
+	if tx["type"] == nil {
+		return nil
+	}
+	txType, err := hexUint64(tx, "type")
+	if err != nil {
+		return err
+	}
+	simulation.Type = uint8(txType)
+
+	if simulation.Type >= types.AccessListTxType && tx["accessList"] != nil {
+		// the access list has the same JSON encoding in the RPC response
+		raw, err := json.Marshal(tx["accessList"])
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, &simulation.AccessList); err != nil {
+			return fmt.Errorf("invalid accessList: %w", err)
+		}
+	}
+	if simulation.Type >= types.DynamicFeeTxType {
+		if simulation.GasFeeCap, err = hexBig(tx, "maxFeePerGas"); err != nil {
+			return err
+		}
+		if simulation.GasTipCap, err = hexBig(tx, "maxPriorityFeePerGas"); err != nil {
+			return err
+		}
+	}
+	if simulation.Type == types.BlobTxType {
+		if simulation.BlobFeeCap, err = hexBig(tx, "maxFeePerBlobGas"); err != nil {
+			return err
+		}
+		hashes, _ := tx["blobVersionedHashes"].([]interface{})
+		for _, hash := range hashes {
+			h, ok := hash.(string)
+			if !ok {
+				return fmt.Errorf("invalid blobVersionedHashes")
+			}
+			simulation.BlobHashes = append(simulation.BlobHashes, common.HexToHash(h))
+		}
+	}
+	return nil
+}
+
+// effectiveGasPrice is the price per gas paid by an EIP-1559 transaction in a
+// block with the given base fee.
+func effectiveGasPrice(feeCap, tipCap, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(feeCap)
+	}
+	price := new(big.Int).Set(baseFee)
+	if tipCap != nil {
+		price.Add(price, tipCap)
+	}
+	if price.Cmp(feeCap) > 0 {
+		return new(big.Int).Set(feeCap)
+	}
+	return price
+}
+
+// chainConfig returns the fork schedule of a known chain, nil lets the runtime
+// default to every fork active on the chain of the config ChainId.
+func chainConfig(chainId uint64) *params.ChainConfig {
+	switch chainId {
+	case 1:
+		return params.MainnetChainConfig
+	}
+	return nil
+}
+
+func hexBig(m map[string]interface{}, key string) (*big.Int, error) {
+	s, ok := m[key].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing field %s", key)
+	}
+	v, err := hexutil.DecodeBig(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func hexUint64(m map[string]interface{}, key string) (uint64, error) {
+	s, ok := m[key].(string)
+	if !ok {
+		return 0, fmt.Errorf("missing field %s", key)
+	}
+	v, err := hexutil.DecodeUint64(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,170 @@
+package evm_simulator
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+func TestSimulationFromTypedTx(t *testing.T) {
+	tx := map[string]interface{}{
+		"type":                 "0x3",
+		"from":                 "0x00000000000000000000000000000000000000a1",
+		"to":                   "0x00000000000000000000000000000000000000b2",
+		"gas":                  "0x5208",
+		"gasPrice":             "0x3b9aca00",
+		"maxFeePerGas":         "0x77359400",
+		"maxPriorityFeePerGas": "0x3b9aca00",
+		"maxFeePerBlobGas":     "0x1",
+		"value":                "0x0",
+		"input":                "0x",
+		"blockNumber":          "0x10",
+		"accessList": []interface{}{
+			map[string]interface{}{
+				"address":     "0x00000000000000000000000000000000000000b2",
+				"storageKeys": []interface{}{"0x0000000000000000000000000000000000000000000000000000000000000001"},
+			},
+		},
+		"blobVersionedHashes": []interface{}{"0x01ab000000000000000000000000000000000000000000000000000000000000"},
+	}
+	simulation, err := simulationFromTx(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Type != types.BlobTxType {
+		t.Errorf("type: have %d, want %d", simulation.Type, types.BlobTxType)
+	}
+	if simulation.GasFeeCap.Uint64() != 2e9 || simulation.GasTipCap.Uint64() != 1e9 {
+		t.Errorf("fee caps: have %v/%v", simulation.GasFeeCap, simulation.GasTipCap)
+	}
+	if simulation.BlobFeeCap.Uint64() != 1 || len(simulation.BlobHashes) != 1 {
+		t.Errorf("blob fields: have %v/%v", simulation.BlobFeeCap, simulation.BlobHashes)
+	}
+	if len(simulation.AccessList) != 1 || len(simulation.AccessList[0].StorageKeys) != 1 {
+		t.Fatalf("access list: have %v", simulation.AccessList)
+	}
+	if simulation.AccessList[0].Address != common.HexToAddress("0xb2") {
+		t.Errorf("access list address: have %s", simulation.AccessList[0].Address)
+	}
+
+	simulation.Block = &BlockEnv{Number: big.NewInt(16), BaseFee: big.NewInt(5e8)}
+	cfg := TxSimulationConfig(simulation, nil, nil, nil)
+	if cfg.GasPrice.Uint64() != 1.5e9 {
+		t.Errorf("effective gas price: have %v, want base fee plus tip", cfg.GasPrice)
+	}
+	if cfg.TxType != types.BlobTxType || len(cfg.BlobHashes) != 1 || len(cfg.AccessList) != 1 {
+		t.Errorf("typed fields not in the config: %+v", cfg)
+	}
+
+	// without a block the base fee is unknown
+	simulation.Block = nil
+	if cfg := TxSimulationConfig(simulation, nil, nil, nil); cfg.GasPrice.Uint64() != 1e9 {
+		t.Errorf("gas price without a block: have %v, want the one of the transaction", cfg.GasPrice)
+	}
+}
+
+// hashSource is a fork source of an empty state, serving block hashes and
+// counting their requests.
+type hashSource struct {
+	requests int
+	fail     bool
+}
+
+func (s *hashSource) GetCode(common.Address) ([]byte, error)          { return nil, nil }
+func (s *hashSource) GetBalance(common.Address) (*uint256.Int, error) { return new(uint256.Int), nil }
+func (s *hashSource) GetNonce(common.Address) (uint64, error)         { return 0, nil }
+func (s *hashSource) GetStorageAt(common.Address, common.Hash) (common.Hash, error) {
+	return common.Hash{}, nil
+}
+
+func (s *hashSource) GetStorageRoot(common.Address) (common.Hash, error) {
+	return types.EmptyRootHash, nil
+}
+
+func (s *hashSource) GetBlockHash(number uint64) (common.Hash, error) {
+	s.requests++
+	if s.fail {
+		return common.Hash{}, errors.New("block not found")
+	}
+	return common.BigToHash(new(big.Int).SetUint64(1000 + number)), nil
+}
+
+func TestBlockOverridesBlockHash(t *testing.T) {
+	// returns BLOCKHASH(98), BLOCKHASH(99), BLOCKHASH(99)
+	code := common.FromHex("0x60624060005260634060205260634060405260606000f3")
+	contract := common.HexToAddress("0xb2")
+	overridden := common.HexToHash("0xbeef")
+	simulation := TxSimulation{
+		From:           common.HexToAddress("0xa1"),
+		To:             &contract,
+		Code:           code,
+		BlockNumber:    big.NewInt(100),
+		GasLimit:       100000,
+		Value:          new(big.Int),
+		BlockOverrides: &BlockOverrides{BlockHash: map[uint64]common.Hash{98: overridden}},
+	}
+
+	source := new(hashSource)
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := TxSimulationConfig(simulation, nil, nil, nil)
+	cfg.ForkSource = source
+	result, err := executeSimulation(simulation, cfg, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched := common.BigToHash(big.NewInt(1099))
+	if len(result.Ret) != 96 || common.BytesToHash(result.Ret[:32]) != overridden ||
+		common.BytesToHash(result.Ret[32:64]) != fetched || common.BytesToHash(result.Ret[64:]) != fetched {
+		t.Errorf("have hashes %x", result.Ret)
+	}
+	if source.requests != 1 {
+		t.Errorf("have %d hash requests, want the fetched hash to be cached", source.requests)
+	}
+
+	// a hash that can't be fetched fails the execution rather than being empty
+	source = &hashSource{fail: true}
+	stateDB, err = state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = TxSimulationConfig(simulation, nil, nil, nil)
+	cfg.ForkSource = source
+	if _, err := executeSimulation(simulation, cfg, stateDB, nil); !errors.Is(err, runtime.ErrForkState) {
+		t.Errorf("have error %v, want %v", err, runtime.ErrForkState)
+	}
+
+	// past the block forked from the hashes aren't on chain, they are made up
+	// without asking the source
+	future := big.NewInt(1000)
+	simulation.Code = common.FromHex("0x6103e74060005260206000f3") // returns BLOCKHASH(999)
+	simulation.BlockOverrides = &BlockOverrides{Number: future}
+	source = &hashSource{fail: true}
+	stateDB, err = state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = TxSimulationConfig(simulation, nil, nil, nil)
+	cfg.ForkSource = source
+	cfg.ForkBlock = simulation.BlockNumber
+	result, err = executeSimulation(simulation, cfg, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if made := crypto.Keccak256Hash([]byte("999")); common.BytesToHash(result.Ret) != made {
+		t.Errorf("have future hash %x, want %x", result.Ret, made)
+	}
+	if source.requests != 0 {
+		t.Errorf("have %d hash requests past the fork block", source.requests)
+	}
+}
@@ -0,0 +1,116 @@
+package evm_simulator
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	"github.com/Arjxm/tracer/core/evm"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CallFrame is a call in the format of the callTracer of geth, as returned by
+// debug_traceTransaction with {"tracer": "callTracer", "tracerConfig":
+// {"withLog": true}}.
+type CallFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	To           *common.Address `json:"to,omitempty"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Calls        []*CallFrame    `json:"calls,omitempty"`
+	Logs         []*CallLog      `json:"logs,omitempty"`
+	Value        *hexutil.Big    `json:"value,omitempty"`
+}
+
+// CallLog is a log kept in a CallFrame, Position is the number of calls the
+// frame made before emitting it.
+type CallLog struct {
+	Address  common.Address `json:"address"`
+	Topics   []common.Hash  `json:"topics"`
+	Data     hexutil.Bytes  `json:"data"`
+	Position hexutil.Uint   `json:"position"`
+}
+
+// CallTrace converts the trace of a transaction to the callTracer format. Like
+// geth, the top level call reports the gas limit and the gas used by the whole
+// transaction rather than by its execution.
+func CallTrace(event *TracerEvent, gasLimit, gasUsed uint64) *CallFrame {
+	if event == nil {
+		return nil
+	}
+	frame := newCallFrame(event)
+	frame.Gas, frame.GasUsed = hexutil.Uint64(gasLimit), hexutil.Uint64(gasUsed)
+	return frame
+}
+
+func newCallFrame(event *TracerEvent) *CallFrame {
+	to := event.OnEnter.To
+	frame := &CallFrame{
+		Type:  event.OnEnter.Type,
+		From:  event.OnEnter.From,
+		Gas:   hexutil.Uint64(event.OnEnter.Gas),
+		To:    &to,
+		Input: decodeHex(event.OnEnter.Input),
+	}
+	if event.OnEnter.Value != nil {
+		frame.Value = (*hexutil.Big)(new(big.Int).Set(event.OnEnter.Value))
+	}
+	for _, child := range event.Children {
+		frame.Calls = append(frame.Calls, newCallFrame(child))
+	}
+	// geth drops the logs of the reverted frames
+	for _, log := range event.Logs {
+		if log.Discarded {
+			continue
+		}
+		topics := make([]common.Hash, len(log.Topics))
+		for i, topic := range log.Topics {
+			topics[i] = common.HexToHash(topic)
+		}
+		frame.Logs = append(frame.Logs, &CallLog{
+			Address:  log.Address,
+			Topics:   topics,
+			Data:     decodeHex(log.Data),
+			Position: hexutil.Uint(log.Position),
+		})
+	}
+
+	// the frame of a call that didn't return is left without exit
+	exit := event.OnExit
+	if exit == nil {
+		return frame
+	}
+	frame.GasUsed = hexutil.Uint64(exit.GasUsed)
+	output := decodeHex(exit.Output)
+	// an error that didn't revert the frame is ignored, as geth does
+	if !exit.Reverted || exit.Err == "" || exit.Err == "<nil>" {
+		frame.Output = output
+		return frame
+	}
+	frame.Error = exit.Err
+	if frame.Type == evm.CREATE.String() || frame.Type == evm.CREATE2.String() {
+		frame.To = nil
+	}
+	if exit.Err != evm.ErrExecutionReverted.Error() || len(output) == 0 {
+		return frame
+	}
+	frame.Output = output
+	if reason, err := abi.UnpackRevert(output); err == nil {
+		frame.RevertReason = reason
+	}
+	return frame
+}
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
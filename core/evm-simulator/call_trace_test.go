@@ -0,0 +1,50 @@
+package evm_simulator
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/Arjxm/tracer/core/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCallTrace(t *testing.T) {
+	var (
+		tracer = NewCustomTracer()
+		alice  = common.HexToAddress("0xa1")
+		token  = common.HexToAddress("0xb2")
+		// Error("no")
+		revert = common.FromHex("0x08c379a0" +
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"6e6f000000000000000000000000000000000000000000000000000000000000")
+	)
+	tracer.OnEnter(0, 0xf1, alice, token, []byte{0x01}, 50000, big.NewInt(1))
+	tracer.OnEnter(1, 0xfa, token, alice, nil, 1000, nil)
+	tracer.OnLog(&types.Log{Address: alice})
+	tracer.OnExit(1, revert, 300, evm.ErrExecutionReverted, true)
+	tracer.OnLog(&types.Log{Address: token, Topics: []common.Hash{common.HexToHash("0x01")}, Data: []byte{0x02}})
+	tracer.OnExit(0, []byte{0x03}, 20000, nil, false)
+
+	frame := CallTrace(tracer.Events[0], 60000, 41000)
+	if frame.Gas != 60000 || frame.GasUsed != 41000 {
+		t.Errorf("top level gas: have %d/%d", frame.GasUsed, frame.Gas)
+	}
+	inner := frame.Calls[0]
+	if inner.Error != "execution reverted" || inner.RevertReason != "no" || len(inner.Logs) != 0 {
+		t.Errorf("reverted call: have %+v", inner)
+	}
+
+	raw, err := json.Marshal(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"CALL","from":"0x00000000000000000000000000000000000000a1","gas":"0xea60","gasUsed":"0xa028","to":"0x00000000000000000000000000000000000000b2","input":"0x01","output":"0x03",` +
+		`"calls":[{"type":"STATICCALL","from":"0x00000000000000000000000000000000000000b2","gas":"0x3e8","gasUsed":"0x12c","to":"0x00000000000000000000000000000000000000a1","input":"0x","output":"0x` + common.Bytes2Hex(revert) + `","error":"execution reverted","revertReason":"no"}],` +
+		`"logs":[{"address":"0x00000000000000000000000000000000000000b2","topics":["0x0000000000000000000000000000000000000000000000000000000000000001"],"data":"0x02","position":"0x1"}],"value":"0x1"}`
+	if string(raw) != want {
+		t.Errorf("callTracer JSON:\nhave %s\nwant %s", raw, want)
+	}
+}
@@ -3,45 +3,89 @@ package evm_simulator
 import (
 	"fmt"
 	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"math/big"
 )
 
-func vmConfig(tracer *CustomTracer) vm.Config {
-	return vm.Config{
-		Tracer: &tracing.Hooks{
-			OnEnter: tracer.OnEnter,
-			OnExit:  tracer.OnExit,
-			OnFault: func(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, depth int, err error) {
-				fmt.Printf("OnFault: PC: %d, OpCode: 0x%02x, Gas: %d, Cost: %d, Depth: %d, Err: %v\n", pc, op, gas, cost, depth, err)
-			},
-			//OnOpcode: tracer.OnOpcode,
-			//OnBalanceChange: func(addr common.Address, prev, new *big.Int, reason tracing.BalanceChangeReason) {
-			//	fmt.Printf("OnBalanceChange: Address: %s, Prev: %s, New: %s, Reason: %s\n", addr.Hex(), prev.String(), new.String(), reason)
-			//},
-			//
-			//OnGasChange: func(old, new uint64, reason tracing.GasChangeReason) {
-			//	fmt.Printf("OnGasChange: Old: %d, New: %d", old, new)
-			//},
-			//OnNonceChange: func(addr common.Address, prev, new uint64) {
-			//	fmt.Printf("OnNonceChange: Address: %s, Prev: %d, New: %d\n", addr.Hex(), prev, new)
-			//},
-			//OnCodeChange: func(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
-			//	fmt.Printf("OnCodeChange: Address: %s, PrevCodeHash: %s, CodeHash: %s\n", addr.Hex(), prevCodeHash.Hex(), codeHash.Hex())
-			//},
-			//OnStorageChange: func(addr common.Address, slot common.Hash, prev, new common.Hash) {
-			//	fmt.Printf("OnStorageChange: Address: %s, Slot: %s, Prev: %s, New: %s\n", addr.Hex(), slot.Hex(), prev.Hex(), new.Hex())
-			//},
-			//OnLog: func(log *types.Log) {
-			//	fmt.Printf("OnLog: Address: %s, Topics: %v, Data: %s\n", log.Address.Hex(), log.Topics, hex.EncodeToString(log.Data))
-			//},
+// vmConfig hooks the trace recorder, the state diff recorder and the opcode
+// logger into the EVM, any of them may be nil.
+func vmConfig(tracer *CustomTracer, stateDiff *StateDiffTracer, opLogger *StructLogger) vm.Config {
+	if tracer == nil && stateDiff == nil && opLogger == nil {
+		return vm.Config{}
+	}
+	hooks := &tracing.Hooks{
+		OnTxStart: func(env *tracing.VMContext, tx *types.Transaction, from common.Address) {
+			if tracer != nil {
+				tracer.OnTxStart(env, tx, from)
+			}
+			if stateDiff != nil {
+				stateDiff.OnTxStart(env, tx, from)
+			}
+			if opLogger != nil {
+				opLogger.OnTxStart(env, tx, from)
+			}
+		},
+		OnEnter: func(depth int, typ byte, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+			if tracer != nil {
+				tracer.OnEnter(depth, typ, from, to, input, gas, value)
+			}
+			if stateDiff != nil {
+				stateDiff.OnEnter(depth, typ, from, to, input, gas, value)
+			}
+		},
+		OnExit: func(depth int, output []byte, gasUsed uint64, err error, reverted bool) {
+			if tracer != nil {
+				tracer.OnExit(depth, output, gasUsed, err, reverted)
+			}
+			if stateDiff != nil {
+				stateDiff.OnExit(depth, output, gasUsed, err, reverted)
+			}
+			if opLogger != nil {
+				opLogger.OnExit(depth, output, gasUsed, err, reverted)
+			}
 		},
 	}
+	if stateDiff != nil {
+		hooks.OnBalanceChange = stateDiff.OnBalanceChange
+		hooks.OnNonceChange = stateDiff.OnNonceChange
+		hooks.OnCodeChange = stateDiff.OnCodeChange
+		hooks.OnStorageChange = stateDiff.OnStorageChange
+	}
+	if opLogger != nil {
+		hooks.OnOpcode = opLogger.OnOpcode
+		hooks.OnFault = opLogger.OnFault
+	}
+	if tracer == nil {
+		return vm.Config{Tracer: hooks}
+	}
+	hooks.OnLog = tracer.OnLog
+	if tracer.Opcodes {
+		hooks.OnOpcode = func(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, rData []byte, depth int, err error) {
+			tracer.OnOpcode(pc, op, gas, cost, scope, rData, depth, err)
+			if opLogger != nil {
+				opLogger.OnOpcode(pc, op, gas, cost, scope, rData, depth, err)
+			}
+		}
+	}
+	hooks.OnFault = func(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, depth int, err error) {
+		fmt.Printf("OnFault: PC: %d, OpCode: 0x%02x, Gas: %d, Cost: %d, Depth: %d, Err: %v\n", pc, op, gas, cost, depth, err)
+		if opLogger != nil {
+			opLogger.OnFault(pc, op, gas, cost, scope, depth, err)
+		}
+	}
+	//OnGasChange: func(old, new uint64, reason tracing.GasChangeReason) {
+	//	fmt.Printf("OnGasChange: Old: %d, New: %d", old, new)
+	//},
+	return vm.Config{Tracer: hooks}
 }
 
-func TxSimulationConfig(simulation TxSimulation, tracerRecord *CustomTracer) *runtime.Config {
-	return &runtime.Config{
+// TxSimulationConfig builds the runtime config of simulation, stateDiff and
+// opLogger may be nil when the state changes or the opcodes aren't needed.
+func TxSimulationConfig(simulation TxSimulation, tracerRecord *CustomTracer, stateDiff *StateDiffTracer, opLogger *StructLogger) *runtime.Config {
+	cfg := &runtime.Config{
 		Debug:       true,
 		Origin:      simulation.From,
 		BlockNumber: simulation.BlockNumber,
@@ -49,8 +93,40 @@ func TxSimulationConfig(simulation TxSimulation, tracerRecord *CustomTracer) *ru
 		GasPrice:    simulation.GasPrice,
 		Value:       simulation.Value,
 		ChainId:     simulation.ChainId,
-		EVMConfig:   vmConfig(tracerRecord),
-		Time:        1723484999,
-		BaseFee:     big.NewInt(3310633170),
+		AccessList:  simulation.AccessList,
+		EVMConfig:   vmConfig(tracerRecord, stateDiff, opLogger),
+	}
+	// a simulation stands for a transaction, which always uses up a nonce
+	cfg.IncrementNonce = true
+
+	if block := simulation.Block; block != nil {
+		cfg.ChainConfig = chainConfig(simulation.ChainId)
+		cfg.BlockNumber = block.Number
+		cfg.Time = block.Time
+		cfg.BlockGasLimit = block.GasLimit
+		cfg.Coinbase = block.Coinbase
+		cfg.Difficulty = block.Difficulty
+		cfg.BaseFee = block.BaseFee
+		cfg.BlobBaseFee = block.BlobBaseFee
+		cfg.Random = block.Random
+	}
+	simulation.BlockOverrides.apply(cfg)
+
+	cfg.TxHash = simulation.Hash
+	cfg.TxIndex = simulation.Index
+	cfg.Strict = simulation.Strict
+	cfg.Nonce = simulation.Nonce
+	cfg.TxType = simulation.Type
+	cfg.BlobHashes = simulation.BlobHashes
+	cfg.BlobFeeCap = simulation.BlobFeeCap
+	if simulation.GasFeeCap != nil {
+		cfg.GasFeeCap = simulation.GasFeeCap
+		cfg.GasTipCap = simulation.GasTipCap
+		// priced against the base fee of the block it's executed in, the
+		// price of the simulation is kept when there is no block to tell
+		if cfg.BaseFee != nil {
+			cfg.GasPrice = effectiveGasPrice(simulation.GasFeeCap, simulation.GasTipCap, cfg.BaseFee)
+		}
 	}
+	return cfg
 }
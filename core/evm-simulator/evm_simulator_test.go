@@ -1,11 +1,23 @@
 package evm_simulator
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Arjxm/tracer/core/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -51,3 +63,427 @@ func TestSimulate(t *testing.T) {
 	// check state value
 
 }
+
+// fakeChain is a JSON-RPC node serving a few blocks and transactions, the
+// accounts not listed being empty.
+type fakeChain struct {
+	mu       sync.Mutex
+	blocks   map[uint64]map[string]interface{}
+	txs      map[string]map[string]interface{}
+	code     map[common.Address][]byte
+	balances map[common.Address]*big.Int
+	// estimate answers eth_estimateGas, which fails when it's nil
+	estimate func(params []json.RawMessage) uint64
+	// requests are the methods called, followed by their block
+	requests []string
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{
+		blocks:   make(map[uint64]map[string]interface{}),
+		txs:      make(map[string]map[string]interface{}),
+		code:     make(map[common.Address][]byte),
+		balances: make(map[common.Address]*big.Int),
+	}
+}
+
+// client starts the node, it's stopped with the test.
+func (c *fakeChain) client(t *testing.T) *rpc.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params []json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		result, err := c.serve(req.Method, req.Params)
+		resp := map[string]interface{}{"id": 1, "jsonrpc": "2.0", "result": result}
+		if err != nil {
+			resp["error"] = map[string]interface{}{"code": -32000, "message": err.Error()}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return &rpc.Client{RpcUrl: srv.URL, ChainId: 1}
+}
+
+func (c *fakeChain) serve(method string, params []json.RawMessage) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	str := func(i int) string {
+		var s string
+		if i < len(params) {
+			json.Unmarshal(params[i], &s)
+		}
+		return s
+	}
+	switch method {
+	case "eth_getTransactionByHash":
+		c.requests = append(c.requests, method)
+		return c.txs[str(0)], nil
+	case "eth_getBlockByNumber":
+		c.requests = append(c.requests, method+" "+str(0))
+		number, err := hexutil.DecodeUint64(str(0))
+		if err != nil {
+			// a tag is the last block
+			for n := range c.blocks {
+				number = max(number, n)
+			}
+		}
+		return c.blocks[number], nil
+	case "eth_getCode":
+		c.requests = append(c.requests, method+" "+str(1))
+		return hexutil.Bytes(c.code[common.HexToAddress(str(0))]), nil
+	case "eth_getBalance":
+		c.requests = append(c.requests, method+" "+str(1))
+		balance := c.balances[common.HexToAddress(str(0))]
+		if balance == nil {
+			balance = new(big.Int)
+		}
+		return (*hexutil.Big)(balance), nil
+	case "eth_getTransactionCount":
+		c.requests = append(c.requests, method+" "+str(1))
+		return hexutil.Uint64(0), nil
+	case "eth_getStorageAt":
+		c.requests = append(c.requests, method+" "+str(2))
+		return common.Hash{}, nil
+	case "eth_getProof":
+		c.requests = append(c.requests, method+" "+str(2))
+		return map[string]interface{}{"storageHash": types.EmptyRootHash}, nil
+	case "eth_estimateGas":
+		c.requests = append(c.requests, method+" "+str(1))
+		if c.estimate == nil {
+			return nil, errors.New("estimation unavailable")
+		}
+		return hexutil.Uint64(c.estimate(params)), nil
+	}
+	return nil, fmt.Errorf("method %s not found", method)
+}
+
+// addBlock adds the block at number holding txs, with a base fee of 1 gwei.
+func (c *fakeChain) addBlock(number uint64, txs ...map[string]interface{}) map[string]interface{} {
+	list := make([]interface{}, len(txs))
+	for i, tx := range txs {
+		tx["blockNumber"] = hexutil.EncodeUint64(number)
+		tx["transactionIndex"] = hexutil.EncodeUint64(uint64(i))
+		c.txs[tx["hash"].(string)] = tx
+		list[i] = tx
+	}
+	block := map[string]interface{}{
+		"number":        hexutil.EncodeUint64(number),
+		"hash":          common.BigToHash(new(big.Int).SetUint64(1000 + number)).Hex(),
+		"timestamp":     hexutil.EncodeUint64(1700000000 + 12*number),
+		"gasLimit":      hexutil.EncodeUint64(30000000),
+		"difficulty":    "0x0",
+		"miner":         common.HexToAddress("0xc0").Hex(),
+		"mixHash":       common.HexToHash("0xaa").Hex(),
+		"baseFeePerGas": hexutil.EncodeBig(big.NewInt(1e9)),
+		"transactions":  list,
+	}
+	c.blocks[number] = block
+	return block
+}
+
+// legacyTx is a transaction of from calling to, priced at 2 gwei.
+func legacyTx(hash string, from, to common.Address, nonce uint64) map[string]interface{} {
+	return map[string]interface{}{
+		"hash":     hash,
+		"type":     "0x0",
+		"from":     from.Hex(),
+		"to":       to.Hex(),
+		"nonce":    hexutil.EncodeUint64(nonce),
+		"gas":      hexutil.EncodeUint64(100000),
+		"gasPrice": hexutil.EncodeBig(big.NewInt(2e9)),
+		"value":    "0x0",
+		"input":    "0x",
+	}
+}
+
+// probeCode increments the counter in slot 0, and returns the counter
+// followed by NUMBER, TIMESTAMP, COINBASE, GASPRICE and BASEFEE.
+var probeCode = common.FromHex("0x600054600101806000556000524360205242604052416060523a6080524860a05260c06000f3")
+
+func probe(ret []byte) (counter, number, time uint64, coinbase common.Address, gasPrice, baseFee *big.Int) {
+	word := func(i int) []byte { return ret[32*i : 32*(i+1)] }
+	return new(big.Int).SetBytes(word(0)).Uint64(), new(big.Int).SetBytes(word(1)).Uint64(),
+		new(big.Int).SetBytes(word(2)).Uint64(), common.BytesToAddress(word(3)),
+		new(big.Int).SetBytes(word(4)), new(big.Int).SetBytes(word(5))
+}
+
+func TestSimulateReplayInBlock(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0xa1")
+		contract = common.HexToAddress("0xb2")
+		chain    = newFakeChain()
+	)
+	chain.code[contract] = probeCode
+	chain.balances[sender] = big.NewInt(1e18)
+	chain.addBlock(0x0f)
+	block := chain.addBlock(0x10,
+		legacyTx("0x01", sender, contract, 0),
+		legacyTx("0x02", sender, contract, 1),
+	)
+	sim, err := NewSimulator(chain.client(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := sim.Simulate(TxSimulationReq{ChainId: 1337, TxHash: "0x02", ReplayInBlock: true}, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err != nil {
+		t.Fatalf("replayed transaction failed: %v", result.Err)
+	}
+	counter, number, time, coinbase, gasPrice, baseFee := probe(result.ReturnedData)
+	// the preceding transaction incremented the counter first
+	if counter != 2 {
+		t.Errorf("counter: have %d, want 2", counter)
+	}
+	if number != 0x10 || hexutil.EncodeUint64(time) != block["timestamp"] || coinbase != common.HexToAddress("0xc0") {
+		t.Errorf("header: have number %d, time %d, coinbase %s", number, time, coinbase.Hex())
+	}
+	if gasPrice.Cmp(big.NewInt(2e9)) != 0 || baseFee.Cmp(big.NewInt(1e9)) != 0 {
+		t.Errorf("fees: have gas price %v, base fee %v", gasPrice, baseFee)
+	}
+	if nonce := stateDB.GetNonce(sender); nonce != 2 {
+		t.Errorf("sender nonce: have %d, want 2", nonce)
+	}
+	// the state is forked from the parent block
+	for _, req := range chain.requests {
+		if method, blk, _ := strings.Cut(req, " "); method != "eth_getBlockByNumber" && blk != "" && blk != "0xf" {
+			t.Errorf("state read outside of the parent block: %s", req)
+		}
+	}
+}
+
+func TestExecuteSimulationCreate(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := common.HexToAddress("0xa1")
+	stateDB.SetNonce(sender, 5)
+	// deploys SSTORE(0, 1), STOP
+	initcode := common.FromHex("0x656001600055006000526006601af3")
+	simulation := TxSimulation{From: sender, GasLimit: 100000, Value: new(big.Int), Input: initcode}
+	tracer := NewCustomTracer()
+	cfg := TxSimulationConfig(simulation, tracer, nil, nil)
+
+	result, err := executeSimulation(simulation, cfg, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulationResult := newSimulationResult(simulation, result, nil)
+	want := crypto.CreateAddress(sender, 5)
+	if addr := simulationResult.ContractAddress; addr == nil || *addr != want {
+		t.Fatalf("contract address: have %v, want %s", addr, want.Hex())
+	}
+	if simulationResult.DeployedCodeSize != 6 || len(stateDB.GetCode(want)) != 6 {
+		t.Errorf("deployed code size: have %d", simulationResult.DeployedCodeSize)
+	}
+	if nonce := stateDB.GetNonce(sender); nonce != 6 {
+		t.Errorf("sender nonce: have %d, want 6", nonce)
+	}
+	if len(tracer.Events) != 1 {
+		t.Fatalf("have %d top level frames, want 1", len(tracer.Events))
+	}
+	if enter := tracer.Events[0].OnEnter; enter.Type != "CREATE" || enter.From != sender || enter.To != want {
+		t.Errorf("top level frame: have %s from %s to %s", enter.Type, enter.From.Hex(), enter.To.Hex())
+	}
+}
+
+// revertCode reverts with Error(reason), reason being at most 32 bytes.
+func revertCode(reason string) []byte {
+	code := append([]byte{0x7f, 0x08, 0xc3, 0x79, 0xa0}, make([]byte, 28)...)
+	code = append(code, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x04, 0x52, 0x60, byte(len(reason)), 0x60, 0x24, 0x52, 0x7f)
+	code = append(code, common.RightPadBytes([]byte(reason), 32)...)
+	return append(code, 0x60, 0x44, 0x52, 0x60, 0x64, 0x60, 0x00, 0xfd)
+}
+
+func TestSimulateCallRevert(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0xa1")
+		contract = common.HexToAddress("0xb2")
+		chain    = newFakeChain()
+	)
+	chain.code[contract] = revertCode("no")
+	chain.addBlock(0x10)
+	sim, err := NewSimulator(chain.client(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := sim.SimulateCall(CallSimulationReq{ChainId: 1337, From: sender, To: &contract, Gas: 100000, BlockTag: "0x10"}, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(result.Err, vm.ErrExecutionReverted) {
+		t.Errorf("have error %v, want %v", result.Err, vm.ErrExecutionReverted)
+	}
+	if result.Revert == nil || result.Revert.Name != "Error" || result.Revert.Reason != "no" {
+		t.Errorf("revert reason: have %+v", result.Revert)
+	}
+	if result.GasUsed == 0 || result.CallTrace == nil || result.CallTrace.RevertReason != "no" {
+		t.Errorf("reverted call not traced: gas used %d, call %+v", result.GasUsed, result.CallTrace)
+	}
+}
+
+func TestSimulateBundleRevert(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0xa1")
+		counter  = common.HexToAddress("0xb2")
+		reverter = common.HexToAddress("0xb3")
+		chain    = newFakeChain()
+	)
+	chain.code[counter] = probeCode
+	chain.code[reverter] = revertCode("no")
+	chain.addBlock(0x10)
+	sim, err := NewSimulator(chain.client(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := BundleSimulationReq{ChainId: 1337, BlockTag: "0x10", Txs: []CallSimulationReq{
+		{From: sender, To: &counter, Gas: 100000},
+		{From: sender, To: &reverter, Gas: 100000},
+		{From: sender, To: &counter, Gas: 100000},
+	}}
+	result, err := sim.SimulateBundle(bundle, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 3 {
+		t.Fatalf("have %d results, want 3", len(result.Results))
+	}
+	if result.Results[0].Err != nil || result.Results[2].Err != nil {
+		t.Errorf("counter calls failed: %v, %v", result.Results[0].Err, result.Results[2].Err)
+	}
+	if reverted := result.Results[1]; !errors.Is(reverted.Err, vm.ErrExecutionReverted) || reverted.Revert == nil || reverted.Revert.Reason != "no" {
+		t.Errorf("reverted transaction: have error %v, reason %+v", reverted.Err, reverted.Revert)
+	}
+	// the last transaction runs on the state of the first one
+	if count, _, _, _, _, _ := probe(result.Results[2].ReturnedData); count != 2 {
+		t.Errorf("counter after the bundle: have %d, want 2", count)
+	}
+}
+
+func TestSimulateCallEstimateGas(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0xa1")
+		contract = common.HexToAddress("0xb2")
+		chain    = newFakeChain()
+		estimate []json.RawMessage
+	)
+	chain.code[contract] = probeCode
+	chain.addBlock(0x10)
+	chain.addBlock(0x11)
+	chain.estimate = func(params []json.RawMessage) uint64 {
+		estimate = params
+		return 50000
+	}
+	sim, err := NewSimulator(chain.client(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := CallSimulationReq{
+		ChainId:              1337,
+		From:                 sender,
+		To:                   &contract,
+		MaxFeePerGas:         big.NewInt(3e9),
+		MaxPriorityFeePerGas: big.NewInt(1e9),
+		AccessList:           types.AccessList{{Address: contract, StorageKeys: []common.Hash{{}}}},
+		BlockTag:             "0x10",
+	}
+	result, err := sim.SimulateCall(call, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GasLimit != 50000 {
+		t.Errorf("gas limit: have %d, want the estimate", result.GasLimit)
+	}
+	if len(estimate) != 2 || string(estimate[1]) != `"0x10"` {
+		t.Fatalf("estimated on the wrong block: %s", estimate)
+	}
+	var args struct {
+		From                 common.Address
+		To                   common.Address
+		MaxFeePerGas         *hexutil.Big
+		MaxPriorityFeePerGas *hexutil.Big
+		AccessList           types.AccessList
+	}
+	if err := json.Unmarshal(estimate[0], &args); err != nil {
+		t.Fatal(err)
+	}
+	if args.From != sender || args.To != contract || args.MaxFeePerGas.ToInt().Cmp(call.MaxFeePerGas) != 0 ||
+		args.MaxPriorityFeePerGas.ToInt().Cmp(call.MaxPriorityFeePerGas) != 0 || len(args.AccessList) != 1 {
+		t.Errorf("estimated call: have %s", estimate[0])
+	}
+	if _, _, _, _, gasPrice, _ := probe(result.ReturnedData); gasPrice.Cmp(big.NewInt(2e9)) != 0 {
+		t.Errorf("gas price: have %v, want the base fee and the tip", gasPrice)
+	}
+
+	call.BlockTag = "pending"
+	if _, err := sim.SimulateCall(call, stateDB, nil); err == nil {
+		t.Errorf("simulated on the pending block")
+	}
+}
+
+func TestSimulateForkedBlock(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0xa1")
+		contract = common.HexToAddress("0xb2")
+		chain    = newFakeChain()
+	)
+	chain.code[contract] = probeCode
+	forked := chain.addBlock(0x10)
+	tx := legacyTx("0x01", sender, contract, 0)
+	tx["type"] = "0x2"
+	tx["gasPrice"] = hexutil.EncodeBig(big.NewInt(4e9))
+	tx["maxFeePerGas"] = hexutil.EncodeBig(big.NewInt(5e9))
+	tx["maxPriorityFeePerGas"] = hexutil.EncodeBig(big.NewInt(1e9))
+	chain.addBlock(0x90, tx)
+	sim, err := NewSimulator(chain.client(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := sim.Simulate(TxSimulationReq{ChainId: 1337, TxHash: "0x01"}, stateDB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err != nil {
+		t.Fatalf("simulation failed: %v", result.Err)
+	}
+	// the transaction runs in the block its state is forked from
+	_, number, time, _, gasPrice, baseFee := probe(result.ReturnedData)
+	if number != 0x10 || hexutil.EncodeUint64(time) != forked["timestamp"] {
+		t.Errorf("block: have number %d, time %d", number, time)
+	}
+	if baseFee.Cmp(big.NewInt(1e9)) != 0 || gasPrice.Cmp(big.NewInt(2e9)) != 0 {
+		t.Errorf("fees: have gas price %v, base fee %v", gasPrice, baseFee)
+	}
+}
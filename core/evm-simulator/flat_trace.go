@@ -0,0 +1,220 @@
+package evm_simulator
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/Arjxm/tracer/core/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// FlatCallFrame is a call in the flat format of the trace_transaction method
+// of Parity/OpenEthereum, also served by Erigon and Nethermind.
+type FlatCallFrame struct {
+	Action              FlatCallAction  `json:"action"`
+	BlockHash           *common.Hash    `json:"blockHash"`
+	BlockNumber         uint64          `json:"blockNumber"`
+	Error               string          `json:"error,omitempty"`
+	Result              *FlatCallResult `json:"result,omitempty"`
+	Subtraces           int             `json:"subtraces"`
+	TraceAddress        []int           `json:"traceAddress"`
+	TransactionHash     *common.Hash    `json:"transactionHash"`
+	TransactionPosition uint64          `json:"transactionPosition"`
+	Type                string          `json:"type"`
+}
+
+// FlatCallAction is the call made by a FlatCallFrame, which fields are set
+// depends on its type.
+type FlatCallAction struct {
+	// SelfDestructed, Balance and RefundAddress are set for a suicide
+	SelfDestructed *common.Address `json:"address,omitempty"`
+	Balance        *hexutil.Big    `json:"balance,omitempty"`
+	RefundAddress  *common.Address `json:"refundAddress,omitempty"`
+
+	CallType       string          `json:"callType,omitempty"`
+	CreationMethod string          `json:"creationMethod,omitempty"`
+	From           *common.Address `json:"from,omitempty"`
+	Gas            *hexutil.Uint64 `json:"gas,omitempty"`
+	Init           *hexutil.Bytes  `json:"init,omitempty"`
+	Input          *hexutil.Bytes  `json:"input,omitempty"`
+	To             *common.Address `json:"to,omitempty"`
+	Value          *hexutil.Big    `json:"value,omitempty"`
+}
+
+// FlatCallResult is the outcome of a call, Address and Code are set for a
+// contract creation and Output for the other calls.
+type FlatCallResult struct {
+	Address *common.Address `json:"address,omitempty"`
+	Code    *hexutil.Bytes  `json:"code,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+}
+
+// FlatTraceContext locates a transaction in its block for its flat trace.
+type FlatTraceContext struct {
+	BlockHash   common.Hash
+	BlockNumber *big.Int
+	TxHash      common.Hash
+	TxIndex     int
+	// Precompiles are left out of the trace when called with CALL or
+	// STATICCALL, Parity doesn't trace them
+	Precompiles []common.Address
+}
+
+// parityErrors are the errors of Parity matching the ones of the EVM, the
+// others are reported as is.
+var parityErrors = map[string]string{
+	"contract creation code storage out of gas": "Out of gas",
+	"out of gas":                      "Out of gas",
+	"gas uint64 overflow":             "Out of gas",
+	"max code size exceeded":          "Out of gas",
+	"invalid jump destination":        "Bad jump destination",
+	"execution reverted":              "Reverted",
+	"return data out of bounds":       "Out of bounds",
+	"stack limit reached 1024 (1023)": "Out of stack",
+	"precompiled failed":              "Built-in failed",
+	"invalid input length":            "Built-in failed",
+}
+
+var parityErrorPrefixes = map[string]string{
+	"invalid opcode:": "Bad instruction",
+	"stack underflow": "Stack underflow",
+}
+
+// FlatTrace converts a callTracer trace to the flat trace of Parity, every
+// call followed by its subcalls, in execution order.
+func FlatTrace(frame *CallFrame, ctx FlatTraceContext) ([]*FlatCallFrame, error) {
+	if frame == nil {
+		return nil, nil
+	}
+	return flatten(frame, []int{}, ctx)
+}
+
+func flatten(frame *CallFrame, traceAddress []int, ctx FlatTraceContext) ([]*FlatCallFrame, error) {
+	var flat *FlatCallFrame
+	switch frame.Type {
+	case evm.CREATE.String(), evm.CREATE2.String():
+		flat = newFlatCreate(frame)
+	case evm.SELFDESTRUCT.String():
+		flat = newFlatSelfdestruct(frame)
+	case evm.CALL.String(), evm.STATICCALL.String(), evm.CALLCODE.String(), evm.DELEGATECALL.String():
+		flat = newFlatCall(frame)
+	default:
+		return nil, fmt.Errorf("unknown call type %s", frame.Type)
+	}
+
+	calls := make([]*CallFrame, 0, len(frame.Calls))
+	for _, call := range frame.Calls {
+		if !isPrecompileCall(call, ctx.Precompiles) {
+			calls = append(calls, call)
+		}
+	}
+
+	flat.TraceAddress = traceAddress
+	flat.Subtraces = len(calls)
+	flat.Error = parityError(frame.Error)
+	// the output of a revert holds its reason, the other failures have none
+	if frame.Error != "" && frame.Error != evm.ErrExecutionReverted.Error() {
+		flat.Result = nil
+	}
+	if ctx.BlockHash != (common.Hash{}) {
+		flat.BlockHash = &ctx.BlockHash
+	}
+	if ctx.BlockNumber != nil {
+		flat.BlockNumber = ctx.BlockNumber.Uint64()
+	}
+	if ctx.TxHash != (common.Hash{}) {
+		flat.TransactionHash = &ctx.TxHash
+	}
+	flat.TransactionPosition = uint64(ctx.TxIndex)
+
+	trace := []*FlatCallFrame{flat}
+	for i, call := range calls {
+		children, err := flatten(call, append(slices.Clone(traceAddress), i), ctx)
+		if err != nil {
+			return nil, err
+		}
+		trace = append(trace, children...)
+	}
+	return trace, nil
+}
+
+func newFlatCreate(frame *CallFrame) *FlatCallFrame {
+	var (
+		gas, gasUsed = frame.Gas, frame.GasUsed
+		init, code   = frame.Input, frame.Output
+	)
+	return &FlatCallFrame{
+		Type: strings.ToLower(evm.CREATE.String()),
+		Action: FlatCallAction{
+			CreationMethod: strings.ToLower(frame.Type),
+			From:           &frame.From,
+			Gas:            &gas,
+			Init:           &init,
+			Value:          frame.Value,
+		},
+		Result: &FlatCallResult{
+			Address: frame.To,
+			Code:    &code,
+			GasUsed: &gasUsed,
+		},
+	}
+}
+
+func newFlatCall(frame *CallFrame) *FlatCallFrame {
+	var (
+		gas, gasUsed  = frame.Gas, frame.GasUsed
+		input, output = frame.Input, frame.Output
+	)
+	return &FlatCallFrame{
+		Type: strings.ToLower(evm.CALL.String()),
+		Action: FlatCallAction{
+			CallType: strings.ToLower(frame.Type),
+			From:     &frame.From,
+			Gas:      &gas,
+			Input:    &input,
+			To:       frame.To,
+			Value:    frame.Value,
+		},
+		Result: &FlatCallResult{
+			GasUsed: &gasUsed,
+			Output:  &output,
+		},
+	}
+}
+
+func newFlatSelfdestruct(frame *CallFrame) *FlatCallFrame {
+	return &FlatCallFrame{
+		Type: "suicide",
+		Action: FlatCallAction{
+			SelfDestructed: &frame.From,
+			Balance:        frame.Value,
+			RefundAddress:  frame.To,
+		},
+	}
+}
+
+func isPrecompileCall(frame *CallFrame, precompiles []common.Address) bool {
+	if frame.Type != evm.CALL.String() && frame.Type != evm.STATICCALL.String() {
+		return false
+	}
+	return frame.To != nil && slices.Contains(precompiles, *frame.To)
+}
+
+func parityError(err string) string {
+	if err == "" {
+		return ""
+	}
+	if parity, ok := parityErrors[err]; ok {
+		return parity
+	}
+	for prefix, parity := range parityErrorPrefixes {
+		if strings.HasPrefix(err, prefix) {
+			return parity
+		}
+	}
+	return err
+}
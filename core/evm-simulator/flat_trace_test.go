@@ -0,0 +1,57 @@
+package evm_simulator
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestFlatTrace(t *testing.T) {
+	var (
+		alice     = common.HexToAddress("0xa1")
+		token     = common.HexToAddress("0xb2")
+		ecrecover = common.HexToAddress("0x01")
+		created   = common.HexToAddress("0xc3")
+	)
+	frame := &CallFrame{
+		Type: "CALL", From: alice, To: &token, Gas: 50000, GasUsed: 30000,
+		Value: (*hexutil.Big)(big.NewInt(0)),
+		Calls: []*CallFrame{
+			{Type: "STATICCALL", From: token, To: &ecrecover, Gas: 3000, GasUsed: 3000},
+			{Type: "CREATE2", From: token, To: &created, Gas: 10000, GasUsed: 10000, Input: []byte{0x60}, Error: "out of gas"},
+			{Type: "SELFDESTRUCT", From: token, To: &alice, Value: (*hexutil.Big)(big.NewInt(5))},
+		},
+	}
+	trace, err := FlatTrace(frame, FlatTraceContext{
+		BlockNumber: big.NewInt(10),
+		TxHash:      common.HexToHash("0xff"),
+		TxIndex:     2,
+		Precompiles: []common.Address{ecrecover},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace) != 3 || trace[0].Subtraces != 2 {
+		t.Fatalf("precompile call kept: %d frames, %d subtraces", len(trace), trace[0].Subtraces)
+	}
+	create, suicide := trace[1], trace[2]
+	if create.Type != "create" || create.Action.CreationMethod != "create2" || create.Error != "Out of gas" || create.Result != nil {
+		t.Errorf("failed create: have %+v", create)
+	}
+	if suicide.TraceAddress[0] != 1 || suicide.TransactionPosition != 2 || suicide.BlockNumber != 10 {
+		t.Errorf("position of the selfdestruct: have %+v", suicide)
+	}
+
+	raw, err := json.Marshal(suicide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"action":{"address":"0x00000000000000000000000000000000000000b2","balance":"0x5","refundAddress":"0x00000000000000000000000000000000000000a1"},"blockHash":null,"blockNumber":10,` +
+		`"subtraces":0,"traceAddress":[1],"transactionHash":"0x00000000000000000000000000000000000000000000000000000000000000ff","transactionPosition":2,"type":"suicide"}`
+	if string(raw) != want {
+		t.Errorf("flat trace JSON:\nhave %s\nwant %s", raw, want)
+	}
+}
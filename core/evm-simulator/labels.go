@@ -0,0 +1,295 @@
+package evm_simulator
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Arjxm/tracer/core/decoder"
+	evm "github.com/Arjxm/tracer/core/evm"
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+var (
+	// selectors of the getters of ERC-20 tokens and Uniswap pools
+	symbolSelector   = []byte{0x95, 0xd8, 0x9b, 0x41}
+	decimalsSelector = []byte{0x31, 0x3c, 0xe5, 0x67}
+	token0Selector   = []byte{0x0d, 0xfe, 0x16, 0x81}
+	token1Selector   = []byte{0xd2, 0x12, 0x20, 0xa7}
+	feeSelector      = []byte{0xdd, 0xca, 0x3f, 0x43}
+)
+
+// labelCallGas is the gas of the calls detecting a label, a getter needs far
+// less.
+const labelCallGas = 100000
+
+// tokenAmounts are the functions and events of ERC-20 tokens, and of WETH,
+// whose uint256 arguments and results are amounts of the token.
+var tokenAmounts = map[string]bool{
+	"transfer":     true,
+	"transferFrom": true,
+	"approve":      true,
+	"balanceOf":    true,
+	"allowance":    true,
+	"totalSupply":  true,
+	"mint":         true,
+	"burn":         true,
+	"deposit":      true,
+	"withdraw":     true,
+	"Transfer":     true,
+	"Approval":     true,
+	"Deposit":      true,
+	"Withdrawal":   true,
+}
+
+// annotate labels the addresses of events and formats the token amounts of
+// their decoded calls and logs. When DetectTokens is set, the addresses
+// without label are first looked up as tokens and pools with static calls on
+// a copy of stateDB, which leaves stateDB and record untouched.
+func (s *Simulator) annotate(events []*TracerEvent, cfg *runtime.Config, stateDB *state.StateDB, record *evm.RecordToInitiateState) {
+	if s.Labels == nil {
+		return
+	}
+	if s.DetectTokens {
+		stateDB := stateDB.Copy()
+		record := copyRecord(record)
+		callCfg := *cfg
+		callCfg.GasLimit = labelCallGas
+		call := func(addr common.Address, input []byte) []byte {
+			ret, err := runtime.StaticCall(addr, input, &callCfg, stateDB, record)
+			if err != nil {
+				return nil
+			}
+			return ret
+		}
+		for _, addr := range traceAddresses(events) {
+			s.detectLabel(addr, call, true)
+		}
+	}
+	annotateEvents(events, s.Labels)
+}
+
+// copyRecord returns a record holding copies of the sets of record.
+func copyRecord(record *evm.RecordToInitiateState) *evm.RecordToInitiateState {
+	if record == nil {
+		return nil
+	}
+	return &evm.RecordToInitiateState{
+		AddressCodeSet:    maps.Clone(record.AddressCodeSet),
+		AddressBalanceSet: maps.Clone(record.AddressBalanceSet),
+		AddressNonceSet:   maps.Clone(record.AddressNonceSet),
+		AddressStorageSet: maps.Clone(record.AddressStorageSet),
+		AccessList:        slices.Clone(record.AccessList),
+
+		AddressLocalStorageSet: maps.Clone(record.AddressLocalStorageSet),
+	}
+}
+
+// traceAddresses returns the addresses called, emitting logs or passed as
+// arguments in events, in the order they appear.
+func traceAddresses(events []*TracerEvent) []common.Address {
+	var (
+		addresses []common.Address
+		seen      = make(map[common.Address]bool)
+	)
+	add := func(addr common.Address) {
+		if !seen[addr] {
+			seen[addr] = true
+			addresses = append(addresses, addr)
+		}
+	}
+	addArgs := func(args []decoder.Arg) {
+		for _, arg := range args {
+			if arg.Type == "address" {
+				add(common.HexToAddress(arg.Value))
+			}
+		}
+	}
+	var walk func(events []*TracerEvent)
+	walk = func(events []*TracerEvent) {
+		for _, event := range events {
+			add(event.OnEnter.To)
+			if event.Call != nil {
+				addArgs(event.Call.Args)
+				addArgs(event.Call.Returns)
+			}
+			for _, log := range event.Logs {
+				add(log.Address)
+				if log.Event != nil {
+					addArgs(log.Event.Args)
+				}
+			}
+			walk(event.Children)
+		}
+	}
+	walk(events)
+	return addresses
+}
+
+// detectLabel returns the label of addr, detecting it from its getters when
+// it has none: a Uniswap pool is named after its tokens and fee, when pools
+// is set, and a token after its symbol. The addresses that are neither are
+// remembered so they aren't queried again.
+func (s *Simulator) detectLabel(addr common.Address, call func(common.Address, []byte) []byte, pools bool) *decoder.Label {
+	if label := s.Labels.Get(addr); label != nil {
+		return label
+	}
+	if s.undetected[addr] {
+		return nil
+	}
+	var label *decoder.Label
+	if pools {
+		label = s.detectPool(addr, call)
+	}
+	if label == nil {
+		label = detectToken(addr, call)
+	}
+	if label == nil {
+		if s.undetected == nil {
+			s.undetected = make(map[common.Address]bool)
+		}
+		s.undetected[addr] = true
+		return nil
+	}
+	s.Labels.Set(addr, label)
+	return label
+}
+
+// detectPool names a Uniswap V3 pool as UniswapV3Pool(WETH/USDC 0.05%), and a
+// V2 pair, or one of its forks, as UniswapV2Pair(WETH/USDC).
+func (s *Simulator) detectPool(addr common.Address, call func(common.Address, []byte) []byte) *decoder.Label {
+	token0, ok := unpackAddress(call(addr, token0Selector))
+	if !ok {
+		return nil
+	}
+	token1, ok := unpackAddress(call(addr, token1Selector))
+	if !ok {
+		return nil
+	}
+	tokenName := func(token common.Address) string {
+		if label := s.detectLabel(token, call, false); label != nil {
+			return label.Name
+		}
+		return token.Hex()[:8]
+	}
+	pair := tokenName(token0) + "/" + tokenName(token1)
+
+	if fee, ok := unpackUint(call(addr, feeSelector)); ok && fee.IsUint64() {
+		// the fee is in hundredths of a basis point
+		percent := strconv.FormatFloat(float64(fee.Uint64())/10000, 'f', -1, 64)
+		return &decoder.Label{Name: fmt.Sprintf("UniswapV3Pool(%s %s%%)", pair, percent)}
+	}
+	// a pair is the token of its liquidity
+	label := detectToken(addr, call)
+	if label == nil {
+		return &decoder.Label{Name: fmt.Sprintf("Pair(%s)", pair)}
+	}
+	name := label.Symbol
+	if name == "UNI-V2" {
+		name = "UniswapV2Pair"
+	}
+	label.Name = fmt.Sprintf("%s(%s)", name, pair)
+	return label
+}
+
+// detectToken names an ERC-20 token after its symbol.
+func detectToken(addr common.Address, call func(common.Address, []byte) []byte) *decoder.Label {
+	symbol, ok := unpackString(call(addr, symbolSelector))
+	if !ok || symbol == "" {
+		return nil
+	}
+	label := &decoder.Label{Name: symbol, Symbol: symbol}
+	if decimals, ok := unpackUint(call(addr, decimalsSelector)); ok && decimals.IsUint64() && decimals.Uint64() <= 255 {
+		label.Decimals = new(uint8)
+		*label.Decimals = uint8(decimals.Uint64())
+	}
+	return label
+}
+
+// unpackString decodes a returned string, or a bytes32 as returned by the
+// symbol of older tokens.
+func unpackString(ret []byte) (string, bool) {
+	if len(ret) == 32 {
+		s := string(bytes.TrimRight(ret, "\x00"))
+		return s, printable(s)
+	}
+	if len(ret) < 64 {
+		return "", false
+	}
+	offset, length := new(big.Int).SetBytes(ret[:32]), new(big.Int).SetBytes(ret[32:64])
+	if !offset.IsUint64() || offset.Uint64() != 32 || !length.IsUint64() || length.Uint64() > uint64(len(ret)-64) {
+		return "", false
+	}
+	s := string(ret[64 : 64+length.Uint64()])
+	return s, printable(s)
+}
+
+// printable reports whether s is text, a getter of an other contract would
+// return arbitrary bytes.
+func printable(s string) bool {
+	return utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) < 0
+}
+
+func unpackUint(ret []byte) (*big.Int, bool) {
+	if len(ret) != 32 {
+		return nil, false
+	}
+	return new(big.Int).SetBytes(ret), true
+}
+
+func unpackAddress(ret []byte) (common.Address, bool) {
+	if len(ret) != 32 || !bytes.Equal(ret[:12], make([]byte, 12)) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(ret), true
+}
+
+// annotateEvents sets the labels of the addresses of events, and of the token
+// amounts of their calls and logs.
+func annotateEvents(events []*TracerEvent, labels *decoder.Labels) {
+	for _, event := range events {
+		enter := event.OnEnter
+		enter.FromLabel = labels.Name(enter.From)
+		enter.ToLabel = labels.Name(enter.To)
+		// a delegated call runs on behalf of its caller, a token proxy
+		contract := enter.To
+		if enter.Type == evm.DELEGATECALL.String() || enter.Type == evm.CALLCODE.String() {
+			contract = enter.From
+		}
+		if event.Call != nil {
+			annotateArgs(event.Call.Name, event.Call.Args, labels.Get(contract), labels)
+			annotateArgs(event.Call.Name, event.Call.Returns, labels.Get(contract), labels)
+		}
+		for _, log := range event.Logs {
+			log.AddressLabel = labels.Name(log.Address)
+			if log.Event != nil {
+				annotateArgs(log.Event.Name, log.Event.Args, labels.Get(log.Address), labels)
+			}
+		}
+		annotateEvents(event.Children, labels)
+	}
+}
+
+// annotateArgs labels the addresses among args, and the amounts of token when
+// function is one of the ERC-20 ones.
+func annotateArgs(function string, args []decoder.Arg, token *decoder.Label, labels *decoder.Labels) {
+	for i := range args {
+		arg := &args[i]
+		switch {
+		case arg.Type == "address":
+			arg.Label = labels.Name(common.HexToAddress(arg.Value))
+		case arg.Type == "uint256" && token != nil && token.Decimals != nil && tokenAmounts[function]:
+			if amount, ok := new(big.Int).SetString(arg.Value, 10); ok {
+				arg.Label = decoder.FormatAmount(amount, *token.Decimals) + " " + token.Symbol
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package evm_simulator
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/Arjxm/tracer/core/decoder"
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// getters answers the calls of the detection from the returns of each
+// address, keyed by selector.
+type getters map[common.Address]map[string][]byte
+
+func (g getters) call(addr common.Address, input []byte) []byte {
+	return g[addr][string(input)]
+}
+
+func word(value []byte) []byte {
+	return common.LeftPadBytes(value, 32)
+}
+
+func abiString(s string) []byte {
+	ret := append(word([]byte{0x20}), word(big.NewInt(int64(len(s))).Bytes())...)
+	return append(ret, common.RightPadBytes([]byte(s), (len(s)+31)/32*32)...)
+}
+
+func TestDetectLabels(t *testing.T) {
+	var (
+		usdc     = common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48")
+		weth     = common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+		mkr      = common.HexToAddress("0x9f8f72aa9304c8b593d555f12ef6589cc3a579a2")
+		pool     = common.HexToAddress("0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640")
+		pair     = common.HexToAddress("0xb4e16d0168e52d35cacd2c6185b44666ca12e2a5")
+		sender   = common.HexToAddress("0xa1")
+		eoa      = common.HexToAddress("0xb1")
+		treasury = common.HexToAddress("0xb2")
+	)
+	backend := getters{
+		usdc: {string(symbolSelector): abiString("USDC"), string(decimalsSelector): word([]byte{6})},
+		weth: {string(symbolSelector): abiString("WETH"), string(decimalsSelector): word([]byte{18})},
+		// an older token returning its symbol as bytes32
+		mkr: {string(symbolSelector): common.RightPadBytes([]byte("MKR"), 32), string(decimalsSelector): word([]byte{18})},
+		pool: {
+			string(token0Selector): word(usdc.Bytes()),
+			string(token1Selector): word(weth.Bytes()),
+			string(feeSelector):    word([]byte{0x01, 0xf4}),
+		},
+		pair: {
+			string(token0Selector):   word(usdc.Bytes()),
+			string(token1Selector):   word(weth.Bytes()),
+			string(symbolSelector):   abiString("UNI-V2"),
+			string(decimalsSelector): word([]byte{18}),
+		},
+		// arbitrary bytes aren't a symbol
+		eoa: {string(symbolSelector): bytes.Repeat([]byte{0xff}, 32)},
+	}
+	sim := &Simulator{Labels: decoder.NewLabels()}
+	sim.Labels.Set(treasury, &decoder.Label{Name: "Treasury"})
+
+	for _, test := range []struct {
+		addr common.Address
+		want string
+	}{
+		{usdc, "USDC"},
+		{mkr, "MKR"},
+		{pool, "UniswapV3Pool(USDC/WETH 0.05%)"},
+		{pair, "UniswapV2Pair(USDC/WETH)"},
+		{eoa, ""},
+		{treasury, "Treasury"},
+	} {
+		label := sim.detectLabel(test.addr, backend.call, true)
+		if name := sim.Labels.Name(test.addr); name != test.want || (label == nil) != (test.want == "") {
+			t.Errorf("%s: have %q, want %q", test.addr.Hex(), name, test.want)
+		}
+	}
+	if label := sim.Labels.Get(usdc); label.Decimals == nil || *label.Decimals != 6 {
+		t.Errorf("USDC decimals: have %v", label.Decimals)
+	}
+	if !sim.undetected[eoa] {
+		t.Errorf("address without label not remembered")
+	}
+
+	events := []*TracerEvent{{
+		OnEnter: &OnEnterEvent{Type: "CALL", From: sender, To: usdc},
+		Call: &decoder.DecodedCall{Name: "transfer", Args: []decoder.Arg{
+			{Name: "to", Type: "address", Value: pool.Hex()},
+			{Name: "value", Type: "uint256", Value: "2500000"},
+		}},
+		Logs: []*LogEvent{{
+			Address: usdc,
+			Event: &decoder.DecodedEvent{Name: "Transfer", Args: []decoder.Arg{
+				{Name: "from", Type: "address", Value: sender.Hex(), Indexed: true},
+				{Name: "to", Type: "address", Value: pool.Hex(), Indexed: true},
+				{Name: "value", Type: "uint256", Value: "2500000"},
+			}},
+		}},
+	}}
+	annotateEvents(events, sim.Labels)
+	enter := events[0].OnEnter
+	if enter.FromLabel != "" || enter.ToLabel != "USDC" {
+		t.Errorf("frame labels: have %q -> %q", enter.FromLabel, enter.ToLabel)
+	}
+	args := events[0].Call.Args
+	if args[0].Label != "UniswapV3Pool(USDC/WETH 0.05%)" || args[1].Label != "2.5 USDC" {
+		t.Errorf("call labels: have %q, %q", args[0].Label, args[1].Label)
+	}
+	log := events[0].Logs[0]
+	if log.AddressLabel != "USDC" || log.Event.Args[2].Label != "2.5 USDC" {
+		t.Errorf("log labels: have %q, %q", log.AddressLabel, log.Event.Args[2].Label)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// loads slot 0 and returns "USDC" as a bytes32 to any call, a symbol but
+	// neither decimals nor a token of a pool
+	token := common.HexToAddress("0xb2")
+	stateDB.SetCode(token, []byte{0x60, 0x00, 0x54, 0x50, 0x63, 'U', 'S', 'D', 'C', 0x60, 0xe0, 0x1b, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3})
+
+	events := []*TracerEvent{{OnEnter: &OnEnterEvent{Type: "CALL", From: common.HexToAddress("0xa1"), To: token}}}
+	sim := &Simulator{Labels: decoder.NewLabels(), DetectTokens: true}
+	// the calls run on a fork, the token being the only account known locally
+	record := sharedRecord(nil)
+	record.AddressCodeSet[token] = struct{}{}
+	record.AddressBalanceSet[token] = struct{}{}
+	record.AddressNonceSet[token] = struct{}{}
+	root := stateDB.IntermediateRoot(true)
+	cfg := &runtime.Config{Origin: common.HexToAddress("0xa1"), ForkSource: new(hashSource)}
+	sim.annotate(events, cfg, stateDB, record)
+	if label := sim.Labels.Get(token); label == nil || label.Name != "USDC" || label.Decimals != nil {
+		t.Fatalf("have %+v", label)
+	}
+	// the detection doesn't show in the simulation
+	if have := stateDB.IntermediateRoot(true); have != root {
+		t.Errorf("state root: have %x, want %x", have, root)
+	}
+	if len(record.AddressCodeSet) != 1 || len(record.AddressBalanceSet) != 1 || len(record.AddressNonceSet) != 1 || len(record.AddressStorageSet) != 0 {
+		t.Errorf("record: have %+v", record)
+	}
+	if events[0].OnEnter.ToLabel != "USDC" {
+		t.Errorf("frame label: have %q", events[0].OnEnter.ToLabel)
+	}
+}
@@ -0,0 +1,75 @@
+package evm_simulator
+
+import (
+	"fmt"
+	"math/big"
+
+	evm "github.com/Arjxm/tracer/core/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/holiman/uint256"
+)
+
+// OverrideAccount replaces fields of an account of the forked state, like the
+// state override set of eth_call. A nil field keeps the forked value, an empty
+// non-nil Code removes the code. State replaces the whole storage whereas
+// StateDiff only replaces the given slots, so they can't be both set.
+type OverrideAccount struct {
+	Nonce     *uint64
+	Code      []byte
+	Balance   *big.Int
+	State     map[common.Hash]common.Hash
+	StateDiff map[common.Hash]common.Hash
+}
+
+// StateOverride is the set of accounts to override before a simulation.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply writes the overrides into stateDB and marks them in record, so the
+// fork never replaces them with the chain values.
+func (o StateOverride) Apply(stateDB *state.StateDB, record *evm.RecordToInitiateState) error {
+	if len(o) == 0 {
+		return nil
+	}
+	for addr, account := range o {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both State and StateDiff overrides", addr.Hex())
+		}
+		if account.Balance != nil && account.Balance.Sign() < 0 {
+			return fmt.Errorf("account %s has a negative balance override", addr.Hex())
+		}
+	}
+
+	// without a source the forked state only marks what is set
+	forked := evm.NewForkedStateDB(stateDB, nil, record)
+	for addr, account := range o {
+		if account.State != nil {
+			forked.SetStorage(addr, account.State)
+			forked.MarkAddressLocalStorage(addr)
+			for slot, value := range account.State {
+				forked.MarkAddressStorage(addr, slot, value)
+			}
+		}
+		for slot, value := range account.StateDiff {
+			forked.SetState(addr, slot, value)
+			forked.MarkAddressStorage(addr, slot, value)
+		}
+		if account.Nonce != nil {
+			forked.SetNonce(addr, *account.Nonce)
+			forked.MarkAddressNonce(addr)
+		}
+		if account.Code != nil {
+			forked.SetCode(addr, account.Code)
+			forked.MarkAddressCode(addr)
+		}
+		if account.Balance != nil {
+			forked.SetBalance(addr, uint256.MustFromBig(account.Balance), tracing.BalanceChangeUnspecified)
+			forked.MarkAddressBalance(addr)
+		}
+	}
+	// the overrides are the state the simulation starts from, so they must
+	// read as committed (e.g. for SSTORE gas), empty accounts are kept
+	forked.Finalise(false)
+	return nil
+}
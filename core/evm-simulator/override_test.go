@@ -0,0 +1,90 @@
+package evm_simulator
+
+import (
+	"math/big"
+	"testing"
+
+	evm "github.com/Arjxm/tracer/core/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// chainSource returns the same non-zero values for every account and slot.
+type chainSource struct{}
+
+func (chainSource) GetCode(common.Address) ([]byte, error) { return []byte{0x60, 0x00}, nil }
+func (chainSource) GetBalance(common.Address) (*uint256.Int, error) {
+	return uint256.NewInt(1000), nil
+}
+func (chainSource) GetNonce(common.Address) (uint64, error) { return 7, nil }
+func (chainSource) GetStorageAt(common.Address, common.Hash) (common.Hash, error) {
+	return common.HexToHash("0xff"), nil
+}
+func (chainSource) GetStorageRoot(common.Address) (common.Hash, error) {
+	return common.HexToHash("0xff"), nil
+}
+func (chainSource) GetBlockHash(uint64) (common.Hash, error) { return common.Hash{}, nil }
+
+func TestStateOverride(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wiped   = common.HexToAddress("0xa1")
+		patched = common.HexToAddress("0xb2")
+		one     = common.HexToHash("0x01")
+		two     = common.HexToHash("0x02")
+		nonce   = uint64(1)
+	)
+	override := StateOverride{
+		wiped: {
+			Code:    []byte{},
+			Balance: big.NewInt(5),
+			State:   map[common.Hash]common.Hash{one: common.HexToHash("0x11")},
+		},
+		patched: {
+			Nonce:     &nonce,
+			StateDiff: map[common.Hash]common.Hash{one: common.HexToHash("0x22")},
+		},
+	}
+	record := sharedRecord(nil)
+	if err := override.Apply(stateDB, record); err != nil {
+		t.Fatal(err)
+	}
+
+	forked := evm.NewForkedStateDB(stateDB, chainSource{}, record)
+	if have := forked.GetBalance(wiped); have.Uint64() != 5 {
+		t.Errorf("balance override: have %v, want 5", have)
+	}
+	if have := forked.GetCodeSize(wiped); have != 0 {
+		t.Errorf("code override: have size %d, want 0", have)
+	}
+	if have := forked.GetCommittedState(wiped, one); have != common.HexToHash("0x11") {
+		t.Errorf("state override: have %x", have)
+	}
+	if have := forked.GetState(wiped, two); have != (common.Hash{}) {
+		t.Errorf("slot outside the state override fetched: %x", have)
+	}
+
+	if have := forked.GetNonce(patched); have != 1 {
+		t.Errorf("nonce override: have %d, want 1", have)
+	}
+	if have := forked.GetState(patched, one); have != common.HexToHash("0x22") {
+		t.Errorf("state diff override: have %x", have)
+	}
+	if have := forked.GetState(patched, two); have != common.HexToHash("0xff") {
+		t.Errorf("slot outside the state diff not fetched: %x", have)
+	}
+	if have := forked.GetBalance(patched); have.Uint64() != 1000 {
+		t.Errorf("balance not fetched: have %v", have)
+	}
+
+	bad := StateOverride{wiped: {State: map[common.Hash]common.Hash{}, StateDiff: map[common.Hash]common.Hash{}}}
+	if err := bad.Apply(stateDB, record); err == nil {
+		t.Error("State and StateDiff both set accepted")
+	}
+}
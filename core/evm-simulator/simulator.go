@@ -1,27 +1,78 @@
 package evm_simulator
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Arjxm/tracer/core/decoder"
 	evm "github.com/Arjxm/tracer/core/evm"
 	"github.com/Arjxm/tracer/core/evm/runtime"
 	"github.com/Arjxm/tracer/core/rpc"
+	"github.com/Arjxm/tracer/core/sourcemap"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
 	"math/big"
-	"strconv"
-	"sync"
 )
 
 type TxSimulationReq struct {
 	ChainId uint64
 	TxHash  string
+	// ReplayInBlock forks from the parent block and executes the transactions
+	// preceding TxHash in its block first, within the real block header. The
+	// transactions are executed in strict mode, like TxSimulation.Strict.
+	ReplayInBlock bool
+	// VerifyReceipt compares the simulation with the receipt of TxHash, it
+	// requires ReplayInBlock for the result to be comparable
+	VerifyReceipt bool
+	// StateOverride is applied right before the transaction
+	StateOverride  StateOverride
+	BlockOverrides *BlockOverrides
+}
+
+// CallSimulationReq is a transaction that isn't signed nor sent, to preview
+// what it would do on top of the state at BlockTag.
+type CallSimulationReq struct {
+	ChainId uint64
+	From    common.Address
+	To      *common.Address
+	Value   *big.Int
+	Data    []byte
+	// Gas is estimated by the node on the state at BlockTag when zero
+	Gas uint64
+	// GasPrice for legacy transactions, or the fee caps of an EIP-1559 one
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	AccessList           types.AccessList
+	// BlockTag is a block number in hex, latest when empty, earliest, safe
+	// or finalized
+	BlockTag       string
+	StateOverride  StateOverride
+	BlockOverrides *BlockOverrides
+	Strict         bool
+}
+
+// BundleSimulationReq is an ordered list of transactions simulated one after
+// the other, each one on the state left by the previous ones. The ChainId and
+// BlockTag of the transactions are ignored in favour of the bundle ones, and so
+// are their overrides and Strict, the bundle StateOverride being applied before
+// the first one and the BlockOverrides and Strict to all of them.
+type BundleSimulationReq struct {
+	ChainId uint64
+	// BlockTag is a block number in hex, latest when empty, earliest, safe
+	// or finalized
+	BlockTag       string
+	StateOverride  StateOverride
+	BlockOverrides *BlockOverrides
+	Strict         bool
+	Txs            []CallSimulationReq
 }
 
 type TxSimulation struct {
 	From        common.Address
-	To          common.Address
+	To          *common.Address // nil for a contract creation, Input being the initcode
 	BlockNumber *big.Int
 	GasLimit    uint64
 	GasPrice    *big.Int
@@ -29,6 +80,30 @@ type TxSimulation struct {
 	Input       []byte
 	Code        []byte
 	ChainId     uint64
+	AccessList  types.AccessList
+	// Block is the block executed in, BlockNumber is only the state forked
+	// from when it's set
+	Block          *BlockEnv
+	BlockOverrides *BlockOverrides
+
+	// Type is the EIP-2718 type of the transaction. GasFeeCap and GasTipCap
+	// are set from EIP-1559 on, GasPrice being then the effective price in
+	// the block; BlobFeeCap and BlobHashes are set for EIP-4844 only.
+	Type       uint8
+	GasFeeCap  *big.Int
+	GasTipCap  *big.Int
+	BlobFeeCap *big.Int
+	BlobHashes []common.Hash
+
+	// Strict executes like a block transaction, see runtime.Config.Strict,
+	// the Nonce of the transaction is checked when set
+	Strict bool
+	Nonce  *uint64
+	// Hash and Index locate a transaction fetched from the chain in its block,
+	// BlockHash is only set when it's replayed in that block
+	Hash      common.Hash
+	Index     int
+	BlockHash common.Hash
 }
 
 type TxSimulationResult struct {
@@ -36,10 +111,49 @@ type TxSimulationResult struct {
 	ReturnedData []byte
 	GasLimit     uint64
 	Trace        []byte
+	// CallTrace is the trace in the format of the callTracer of geth
+	CallTrace *CallFrame
+	// FlatTrace is the trace in the trace_transaction format of Parity
+	FlatTrace []*FlatCallFrame
+	// ContractAddress and DeployedCodeSize are set for a contract creation
+	ContractAddress  *common.Address
+	DeployedCodeSize int
+	// Err is why the simulation failed, e.g. a revert, a strict one still
+	// used gas and changed the state
+	Err error
+	// Revert is the decoded reason of a reverted transaction
+	Revert    *decoder.RevertReason
+	Logs      []*types.Log
+	StateDiff *StateDiff
+	// Verification is set when the receipt was asked to be verified
+	Verification *ReceiptVerification
+}
+
+type BundleSimulationResult struct {
+	Results []*TxSimulationResult
+	// Trace holds the top level call of every transaction, in bundle order
+	Trace     []byte
+	StateDiff *StateDiff
 }
 
 type Simulator struct {
 	RpcClient *rpc.Client
+	// OpcodeLogger streams every step of the simulated transactions when set
+	OpcodeLogger *StructLogger
+	// ABIs are the known contract ABIs used to decode the traces, may be nil
+	ABIs *decoder.Registry
+	// Opcodes records the executed opcodes of every frame in the trace
+	Opcodes bool
+	// Sources map the recorded opcodes to the sources of the contracts, may
+	// be nil
+	Sources *sourcemap.Sources
+	// Labels name the addresses of the traces, may be nil. DetectTokens adds
+	// the labels of the tokens and pools found in them
+	Labels       *decoder.Labels
+	DetectTokens bool
+
+	// addresses found to be neither tokens nor pools
+	undetected map[common.Address]bool
 }
 
 func NewSimulator(RpcClient *rpc.Client) (*Simulator, error) {
@@ -47,120 +161,436 @@ func NewSimulator(RpcClient *rpc.Client) (*Simulator, error) {
 }
 
 func (s *Simulator) Simulate(simulationReq TxSimulationReq, stateDB *state.StateDB, recordInitializer *runtime.RecordToInitiateState) (*TxSimulationResult, error) {
-	traceRecoder := NewCustomTracer()
-
-	tx, _ := s.RpcClient.GetTxByHash(simulationReq.TxHash)
+	tx, err := s.RpcClient.GetTxByHash(simulationReq.TxHash)
+	if err != nil {
+		return nil, err
+	}
 	if tx == nil {
-		fmt.Printf("Error fetching transaction")
+		return nil, fmt.Errorf("transaction %s not found", simulationReq.TxHash)
+	}
+	simulation, err := simulationFromTx(tx, simulationReq.ChainId)
+	if err != nil {
+		return nil, err
+	}
+	if simulation.BlockNumber == nil {
+		return nil, fmt.Errorf("transaction %s is pending", simulationReq.TxHash)
 	}
-	gasLimit, _ := strconv.ParseInt(tx["gas"].(string), 0, 64)
-	gasPrice, _ := strconv.ParseInt(tx["gasPrice"].(string), 0, 64) // 0 allows automatic base detection (hex or decimal)
-	value, _ := strconv.ParseInt(tx["value"].(string), 0, 64)       // Similar conversion for value
+	simulation.BlockOverrides = simulationReq.BlockOverrides
 
-	simulation := TxSimulation{
-		From: common.HexToAddress(tx["from"].(string)), // Convert string to common.Address
-		To:   common.HexToAddress(tx["to"].(string)),
-		BlockNumber: func() *big.Int {
-			v, _ := new(big.Int).SetString(tx["blockNumber"].(string)[2:], 16)
-			return v.Sub(v, big.NewInt(128))
-		}(),
-		GasLimit: uint64(gasLimit),
-		GasPrice: big.NewInt(gasPrice),
-		Value:    big.NewInt(value),
-		Input:    hexutil.MustDecode(tx["input"].(string)),
-		ChainId:  simulationReq.ChainId,
+	if simulationReq.VerifyReceipt && !simulationReq.ReplayInBlock {
+		return nil, errors.New("receipt verification requires ReplayInBlock")
+	}
+
+	if simulationReq.ReplayInBlock {
+		simulation.Strict = true
+		recordInitializer, err = s.replayPrecedingTxs(tx, &simulation, stateDB, recordInitializer)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		simulation.BlockNumber = new(big.Int).Sub(simulation.BlockNumber, big.NewInt(128))
+		// executed within the block forked from, its base fee pricing the
+		// transaction
+		block, err := s.RpcClient.GetBlockByNumber(hexutil.EncodeBig(simulation.BlockNumber), false)
+		if err != nil {
+			return nil, err
+		}
+		if simulation.Block, err = blockEnvFromHeader(block); err != nil {
+			return nil, err
+		}
 	}
 
-	cfg := TxSimulationConfig(simulation, traceRecoder)
+	if !simulationReq.ReplayInBlock {
+		s.estimateGas(&simulation)
+	}
 
-	var (
-		blk     = ""
-		err     error
-		code    = simulation.Code
-		balance = big.NewInt(0)
-		wg      sync.WaitGroup
-	)
+	result, err := s.execute(simulation, simulationReq.StateOverride, stateDB, recordInitializer)
+	if err != nil || !simulationReq.VerifyReceipt {
+		return result, err
+	}
 
-	if simulation.BlockNumber.Cmp(big.NewInt(0)) > 0 {
-		blk = "0x" + simulation.BlockNumber.Text(16)
-	} else {
-		// fetch latest block number
-	}
-
-	if len(code) == 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			codeSize := stateDB.GetCodeSize(simulation.To)
-			if codeSize == 0 {
-				// fetch code of address
-				code, err = s.RpcClient.GetCode(simulation.To.Hex(), blk)
-				if err != nil {
-					return
-				}
-			} else {
-				code = stateDB.GetCode(simulation.To)
-			}
-		}()
-	}
-
-	if simulation.Value.Cmp(big.NewInt(0)) > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			fromBalance := stateDB.GetBalance(simulation.From)
-			if fromBalance.Cmp(common.U2560) <= 0 {
-				balance, err = s.RpcClient.GetBalance(simulation.From.Hex(), blk)
-				if err != nil {
-					return
-				}
-
-				if balance.Cmp(simulation.Value) <= 0 {
-					err = errors.New("insuficient balance to proceed with simulation")
-					return
-				}
-			}
-		}()
-	}
-
-	wg.Wait()
+	receipt, err := s.RpcClient.GetTransactionReceipt(simulationReq.TxHash)
 	if err != nil {
 		return nil, err
 	}
-
-	var recordToInit *evm.RecordToInitiateState
-	if recordInitializer != nil {
-		recordToInit = &evm.RecordToInitiateState{
-			AddressCodeSet:    recordInitializer.AddressCodeSet,
-			AddressBalanceSet: recordInitializer.AddressBalanceSet,
-			AddressStorageSet: recordInitializer.AddressStorageSet,
-			AccessList:        recordInitializer.AccessList,
-		}
+	if receipt == nil {
+		return nil, fmt.Errorf("receipt of %s not found", simulationReq.TxHash)
 	}
+	if result.Verification, err = verifyReceipt(receipt, result); err != nil {
+		return nil, fmt.Errorf("invalid receipt of %s: %w", simulationReq.TxHash, err)
+	}
+	return result, nil
+}
 
-	gas, err := s.RpcClient.EstimateGas(simulation.From, simulation.To, simulation.Value, simulation.Input)
+// SimulateCall simulates a transaction built from the request instead of one
+// fetched from the chain, within the header of the block at BlockTag.
+func (s *Simulator) SimulateCall(callReq CallSimulationReq, stateDB *state.StateDB, recordInitializer *runtime.RecordToInitiateState) (*TxSimulationResult, error) {
+	block, err := s.RpcClient.GetBlockByNumber(callReq.BlockTag, false)
 	if err != nil {
-	} else {
-		cfg.GasLimit = gas
+		return nil, err
+	}
+	env, err := blockEnvFromHeader(block)
+	if err != nil {
+		return nil, err
+	}
+
+	simulation := TxSimulation{
+		From:        callReq.From,
+		To:          callReq.To,
+		BlockNumber: env.Number,
+		GasLimit:    callReq.Gas,
+		GasPrice:    callReq.GasPrice,
+		Value:       callReq.Value,
+		Input:       callReq.Data,
+		ChainId:     callReq.ChainId,
+		AccessList:  callReq.AccessList,
+		Block:       env,
+
+		BlockOverrides: callReq.BlockOverrides,
+		Strict:         callReq.Strict,
+	}
+	if simulation.Value == nil {
+		simulation.Value = new(big.Int)
+	}
+	setCallFees(&simulation, callReq)
+	if simulation.GasLimit == 0 {
+		simulation.GasLimit = env.GasLimit
+		s.estimateGas(&simulation)
 	}
 
-	result, err := runtime.Execute(simulation.To, balance, code, simulation.Input, cfg, stateDB, recordToInit)
+	return s.execute(simulation, callReq.StateOverride, stateDB, recordInitializer)
+}
+
+// SimulateBundle simulates the transactions of the bundle in order on stateDB,
+// within the header of the block at BlockTag. Every transaction sees the state
+// left by the previous ones. A failed transaction, reverted or invalid, gets
+// its error in its result and the next ones still run, only a broken fork
+// state aborts the bundle.
+func (s *Simulator) SimulateBundle(bundleReq BundleSimulationReq, stateDB *state.StateDB, recordInitializer *runtime.RecordToInitiateState) (*BundleSimulationResult, error) {
+	block, err := s.RpcClient.GetBlockByNumber(bundleReq.BlockTag, false)
 	if err != nil {
-		err = traceRecoder.SaveResultToJSON()
+		return nil, err
+	}
+	env, err := blockEnvFromHeader(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if recordInitializer == nil {
+		recordInitializer = &runtime.RecordToInitiateState{}
+	}
+	shared := sharedRecord(recordInitializer)
+	shared.AccessList = recordInitializer.AccessList
+	if err := bundleReq.StateOverride.Apply(stateDB, shared); err != nil {
+		return nil, err
+	}
+
+	var (
+		traceRecoder = NewCustomTracer()
+		stateDiffs   = make([]*StateDiff, 0, len(bundleReq.Txs))
+		results      = make([]*TxSimulationResult, 0, len(bundleReq.Txs))
+	)
+	traceRecoder.ABIs = s.ABIs
+	traceRecoder.Opcodes = s.Opcodes
+	traceRecoder.Sources = s.Sources
+	for i, callReq := range bundleReq.Txs {
+		simulation := TxSimulation{
+			From:        callReq.From,
+			To:          callReq.To,
+			BlockNumber: env.Number,
+			GasLimit:    callReq.Gas,
+			GasPrice:    callReq.GasPrice,
+			Value:       callReq.Value,
+			Input:       callReq.Data,
+			ChainId:     bundleReq.ChainId,
+			AccessList:  callReq.AccessList,
+			Block:       env,
+
+			BlockOverrides: bundleReq.BlockOverrides,
+			Strict:         bundleReq.Strict,
+		}
+		if simulation.Value == nil {
+			simulation.Value = new(big.Int)
+		}
+		setCallFees(&simulation, callReq)
+		// the node can't estimate on top of the previous transactions
+		if simulation.GasLimit == 0 {
+			simulation.GasLimit = env.GasLimit
+		}
+
+		stateDiff := NewStateDiffTracer()
+		cfg := TxSimulationConfig(simulation, traceRecoder, stateDiff, s.OpcodeLogger)
+		s.fork(cfg, simulation)
+
+		firstEvent := len(traceRecoder.Events)
+		result, err := executeSimulation(simulation, cfg, stateDB, shared)
+		if errors.Is(err, runtime.ErrForkState) {
+			return nil, fmt.Errorf("transaction %d of bundle: %w", i, err)
+		}
 		if err != nil {
+			// an invalid transaction doesn't run, so it leaves no trace
+			results = append(results, &TxSimulationResult{GasLimit: simulation.GasLimit, Err: err})
+			continue
+		}
+		s.annotate(traceRecoder.Events[firstEvent:], cfg, stateDB, shared)
+		trace, err := json.MarshalIndent(traceRecoder.Events[firstEvent:], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		simulationResult := newSimulationResult(simulation, result, trace)
+		simulationResult.CallTrace = callTrace(traceRecoder.Events[firstEvent:], simulationResult)
+		simulationResult.Revert = revertReason(traceRecoder.Events[firstEvent:])
+		if simulationResult.FlatTrace, err = flatTrace(simulation, cfg, simulationResult); err != nil {
 			return nil, err
 		}
+		simulationResult.StateDiff = stateDiff.Result()
+		stateDiffs = append(stateDiffs, simulationResult.StateDiff)
+		results = append(results, simulationResult)
+	}
+
+	if err := traceRecoder.SaveResultToJSON(); err != nil {
+		return nil, err
+	}
+	return &BundleSimulationResult{
+		Results:   results,
+		Trace:     traceRecoder.GetResultFromJSON(),
+		StateDiff: MergeStateDiffs(stateDiffs...),
+	}, nil
+}
+
+// execute runs simulation on stateDB forked from its BlockNumber once override
+// is applied, and collects the trace of the execution.
+func (s *Simulator) execute(simulation TxSimulation, override StateOverride, stateDB *state.StateDB, recordInitializer *runtime.RecordToInitiateState) (*TxSimulationResult, error) {
+	traceRecoder := NewCustomTracer()
+	traceRecoder.ABIs = s.ABIs
+	traceRecoder.Opcodes = s.Opcodes
+	traceRecoder.Sources = s.Sources
+	stateDiff := NewStateDiffTracer()
+
+	cfg := TxSimulationConfig(simulation, traceRecoder, stateDiff, s.OpcodeLogger)
+	s.fork(cfg, simulation)
+
+	recordToInit := sharedRecord(recordInitializer)
+	if recordInitializer != nil {
+		recordToInit.AccessList = recordInitializer.AccessList
+	}
+	if err := override.Apply(stateDB, recordToInit); err != nil {
 		return nil, err
+	}
 
+	result, err := executeSimulation(simulation, cfg, stateDB, recordToInit)
+	if err != nil {
+		return nil, err
 	}
+	s.annotate(traceRecoder.Events, cfg, stateDB, recordToInit)
 	err = traceRecoder.SaveResultToJSON()
 	if err != nil {
 		return nil, err
 	}
 
-	return &TxSimulationResult{
+	simulationResult := newSimulationResult(simulation, result, traceRecoder.GetResultFromJSON())
+	simulationResult.CallTrace = callTrace(traceRecoder.Events, simulationResult)
+	simulationResult.Revert = revertReason(traceRecoder.Events)
+	if simulationResult.FlatTrace, err = flatTrace(simulation, cfg, simulationResult); err != nil {
+		return nil, err
+	}
+	simulationResult.StateDiff = stateDiff.Result()
+	return simulationResult, nil
+}
+
+func newSimulationResult(simulation TxSimulation, result *runtime.ExecutionResult, trace []byte) *TxSimulationResult {
+	simulationResult := &TxSimulationResult{
 		ReturnedData: result.Ret,
 		GasUsed:      result.GasUsed,
-		Trace:        traceRecoder.GetResultFromJSON(),
+		GasLimit:     simulation.GasLimit,
+		Trace:        trace,
+		Err:          result.Err,
+		Logs:         result.Logs,
+	}
+	if simulation.To == nil && result.Err == nil {
+		simulationResult.ContractAddress = &result.ContractAddress
+		simulationResult.DeployedCodeSize = result.CodeSize
+	}
+	return simulationResult
+}
+
+// callTrace converts the top level call of a transaction among events, if the
+// transaction got to run.
+func callTrace(events []*TracerEvent, result *TxSimulationResult) *CallFrame {
+	if len(events) == 0 {
+		return nil
+	}
+	return CallTrace(events[0], result.GasLimit, result.GasUsed)
+}
+
+// revertReason returns the decoded reason of the top level call among events
+// when it reverted.
+func revertReason(events []*TracerEvent) *decoder.RevertReason {
+	if len(events) == 0 || events[0].OnExit == nil || !events[0].OnExit.Reverted {
+		return nil
+	}
+	return events[0].OnExit.Revert
+}
+
+// flatTrace converts the call trace of result once cfg was executed, leaving
+// out the precompiles active in its block.
+func flatTrace(simulation TxSimulation, cfg *runtime.Config, result *TxSimulationResult) ([]*FlatCallFrame, error) {
+	rules := cfg.ChainConfig.Rules(cfg.BlockNumber, cfg.Random != nil, cfg.Time)
+	return FlatTrace(result.CallTrace, FlatTraceContext{
+		BlockHash:   simulation.BlockHash,
+		BlockNumber: cfg.BlockNumber,
+		TxHash:      simulation.Hash,
+		TxIndex:     simulation.Index,
+		Precompiles: evm.ActivePrecompiles(rules),
+	})
+}
+
+// estimateGas sets the gas limit of simulation to the estimate of the node on
+// the state it's forked from, the overrides aside. The limit is kept when the
+// node can't estimate it.
+func (s *Simulator) estimateGas(simulation *TxSimulation) {
+	call := rpc.CallArgs{
+		From:       simulation.From,
+		To:         simulation.To,
+		Value:      simulation.Value,
+		Data:       simulation.Input,
+		AccessList: simulation.AccessList,
+	}
+	if simulation.GasFeeCap != nil {
+		call.MaxFeePerGas = simulation.GasFeeCap
+		call.MaxPriorityFeePerGas = simulation.GasTipCap
+	} else {
+		call.GasPrice = simulation.GasPrice
+	}
+	gas, err := s.RpcClient.EstimateGas(call, hexutil.EncodeBig(simulation.BlockNumber))
+	if err == nil {
+		simulation.GasLimit = gas
+	}
+}
+
+// setCallFees sets the type and the fees of simulation from the ones of the
+// request.
+func setCallFees(simulation *TxSimulation, callReq CallSimulationReq) {
+	switch {
+	case simulation.GasPrice == nil && callReq.MaxFeePerGas != nil:
+		simulation.Type = types.DynamicFeeTxType
+		simulation.GasFeeCap = callReq.MaxFeePerGas
+		simulation.GasTipCap = callReq.MaxPriorityFeePerGas
+	case callReq.AccessList != nil:
+		simulation.Type = types.AccessListTxType
+	}
+}
+
+// fork sets cfg to read the missing state, and the block hashes that aren't
+// overridden, from the chain at the BlockNumber of simulation.
+func (s *Simulator) fork(cfg *runtime.Config, simulation TxSimulation) {
+	cfg.ForkSource = s.RpcClient.ForkAt(simulation.BlockNumber)
+	cfg.ForkBlock = simulation.BlockNumber
+}
+
+// executeSimulation runs simulation through the runtime as a call, or as a
+// contract creation when it has no recipient.
+func executeSimulation(simulation TxSimulation, cfg *runtime.Config, stateDB *state.StateDB, recordToInit *evm.RecordToInitiateState) (*runtime.ExecutionResult, error) {
+	if simulation.To == nil {
+		return runtime.Create(big.NewInt(0), simulation.Input, cfg, stateDB, recordToInit)
+	}
+	return runtime.Execute(*simulation.To, big.NewInt(0), simulation.Code, simulation.Input, cfg, stateDB, recordToInit)
+}
+
+// replayPrecedingTxs sets simulation to run in the real block of tx on top of
+// its parent state, and executes on stateDB every transaction placed before tx
+// in that block. The returned record holds the state fetched while doing so.
+func (s *Simulator) replayPrecedingTxs(tx map[string]interface{}, simulation *TxSimulation, stateDB *state.StateDB, record *runtime.RecordToInitiateState) (*runtime.RecordToInitiateState, error) {
+	block, err := s.RpcClient.GetBlockByNumber(hexutil.EncodeBig(simulation.BlockNumber), true)
+	if err != nil {
+		return nil, err
+	}
+	env, err := blockEnvFromHeader(block)
+	if err != nil {
+		return nil, err
+	}
+	txIndex, err := hexUint64(tx, "transactionIndex")
+	if err != nil {
+		return nil, err
+	}
+
+	simulation.Block = env
+	if hash, ok := block["hash"].(string); ok {
+		simulation.BlockHash = common.HexToHash(hash)
+	}
+	simulation.BlockNumber = new(big.Int).Sub(env.Number, big.NewInt(1))
+
+	if record == nil {
+		record = &runtime.RecordToInitiateState{}
+	}
+	shared := sharedRecord(record)
+
+	txs, _ := block["transactions"].([]interface{})
+	for i := uint64(0); i < txIndex && i < uint64(len(txs)); i++ {
+		blockTx, ok := txs[i].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("transaction %d of block %s not returned", i, env.Number)
+		}
+		preceding, err := simulationFromTx(blockTx, simulation.ChainId)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d of block %s: %w", i, env.Number, err)
+		}
+		preceding.Block = env
+		preceding.BlockNumber = simulation.BlockNumber
+		preceding.BlockOverrides = simulation.BlockOverrides
+		preceding.Strict = true
+
+		cfg := TxSimulationConfig(preceding, nil, nil, nil)
+		s.fork(cfg, preceding)
+
+		// a failed transaction is fine, it may have failed on chain as well,
+		// only a broken fork state makes the replay pointless
+		_, err = executeSimulation(preceding, cfg, stateDB, shared)
+		if errors.Is(err, runtime.ErrForkState) {
+			return nil, err
+		}
+	}
+
+	return &runtime.RecordToInitiateState{
+		AddressCodeSet:    shared.AddressCodeSet,
+		AddressBalanceSet: shared.AddressBalanceSet,
+		AddressNonceSet:   shared.AddressNonceSet,
+		AddressStorageSet: shared.AddressStorageSet,
+		AccessList:        record.AccessList,
+
+		AddressLocalStorageSet: shared.AddressLocalStorageSet,
 	}, nil
 }
+
+// sharedRecord returns a record using the maps of record, creating the missing
+// ones. The maps being shared by every execution, whatever gets fetched is
+// recorded even when a transaction fails.
+func sharedRecord(record *runtime.RecordToInitiateState) *evm.RecordToInitiateState {
+	if record == nil {
+		record = &runtime.RecordToInitiateState{}
+	}
+	shared := &evm.RecordToInitiateState{
+		AddressCodeSet:    record.AddressCodeSet,
+		AddressBalanceSet: record.AddressBalanceSet,
+		AddressNonceSet:   record.AddressNonceSet,
+		AddressStorageSet: record.AddressStorageSet,
+
+		AddressLocalStorageSet: record.AddressLocalStorageSet,
+	}
+	if shared.AddressCodeSet == nil {
+		shared.AddressCodeSet = make(map[common.Address]struct{})
+	}
+	if shared.AddressBalanceSet == nil {
+		shared.AddressBalanceSet = make(map[common.Address]struct{})
+	}
+	if shared.AddressNonceSet == nil {
+		shared.AddressNonceSet = make(map[common.Address]struct{})
+	}
+	if shared.AddressStorageSet == nil {
+		shared.AddressStorageSet = make(map[string]common.Hash)
+	}
+	if shared.AddressLocalStorageSet == nil {
+		shared.AddressLocalStorageSet = make(map[common.Address]struct{})
+	}
+	return shared
+}
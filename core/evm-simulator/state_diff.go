@@ -0,0 +1,366 @@
+package evm_simulator
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// AccountState holds the fields of an account that took part in a diff, a nil
+// field was not modified.
+type AccountState struct {
+	Balance  *big.Int
+	Nonce    *uint64
+	Code     []byte
+	CodeHash *common.Hash
+	Storage  map[common.Hash]common.Hash
+}
+
+// MarshalJSON encodes the account like the prestateTracer of geth does.
+func (a *AccountState) MarshalJSON() ([]byte, error) {
+	var nonce uint64
+	if a.Nonce != nil {
+		nonce = *a.Nonce
+	}
+	return json.Marshal(struct {
+		Balance  *hexutil.Big                `json:"balance,omitempty"`
+		Code     hexutil.Bytes               `json:"code,omitempty"`
+		CodeHash *common.Hash                `json:"codeHash,omitempty"`
+		Nonce    uint64                      `json:"nonce,omitempty"`
+		Storage  map[common.Hash]common.Hash `json:"storage,omitempty"`
+	}{
+		Balance:  (*hexutil.Big)(a.Balance),
+		Code:     a.Code,
+		CodeHash: a.CodeHash,
+		Nonce:    nonce,
+		Storage:  a.Storage,
+	})
+}
+
+// StateDiff is the state of every modified account before and after the
+// simulation, it has the layout of the prestateTracer output in diffMode: Pre
+// holds the whole account but only the modified slots, Post only what was
+// modified, and an account created by the simulation isn't in Pre.
+type StateDiff struct {
+	Pre  map[common.Address]*AccountState `json:"pre"`
+	Post map[common.Address]*AccountState `json:"post"`
+}
+
+type stateChange struct {
+	addr common.Address
+	// only one of the following is set, matching the hook that produced it
+	balance *[2]*big.Int
+	nonce   *[2]uint64
+	code    *[2]codeState
+	slot    *common.Hash
+	value   [2]common.Hash
+}
+
+type codeState struct {
+	hash common.Hash
+	code []byte
+}
+
+// StateDiffTracer records the state changes reported by the StateDB hooks of
+// a transaction. The changes made inside a reverted call frame are dropped on
+// its exit, so only what the simulation actually left behind is part of the
+// diff.
+type StateDiffTracer struct {
+	changes []stateChange
+	// number of changes recorded when entering every open frame
+	frames []int
+
+	// state of the transaction, read the first time an account is touched
+	// to fill in the fields it doesn't modify
+	state    tracing.StateDB
+	accounts map[common.Address]*AccountState
+}
+
+func NewStateDiffTracer() *StateDiffTracer {
+	return &StateDiffTracer{
+		changes:  make([]stateChange, 0),
+		frames:   make([]int, 0),
+		accounts: make(map[common.Address]*AccountState),
+	}
+}
+
+func (t *StateDiffTracer) OnTxStart(env *tracing.VMContext, tx *types.Transaction, from common.Address) {
+	t.state = env.StateDB
+}
+
+func (t *StateDiffTracer) OnEnter(depth int, typ byte, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.frames = append(t.frames, len(t.changes))
+}
+
+func (t *StateDiffTracer) OnExit(depth int, output []byte, gasUsed uint64, err error, reverted bool) {
+	if len(t.frames) == 0 {
+		return
+	}
+	start := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	if reverted {
+		t.changes = t.changes[:start]
+	}
+}
+
+func (t *StateDiffTracer) OnBalanceChange(addr common.Address, prev, new *big.Int, reason tracing.BalanceChangeReason) {
+	t.touch(addr)
+	t.changes = append(t.changes, stateChange{addr: addr, balance: &[2]*big.Int{copyBig(prev), copyBig(new)}})
+}
+
+func (t *StateDiffTracer) OnNonceChange(addr common.Address, prev, new uint64) {
+	t.touch(addr)
+	t.changes = append(t.changes, stateChange{addr: addr, nonce: &[2]uint64{prev, new}})
+}
+
+func (t *StateDiffTracer) OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+	t.touch(addr)
+	t.changes = append(t.changes, stateChange{addr: addr, code: &[2]codeState{{prevCodeHash, prevCode}, {codeHash, code}}})
+}
+
+func (t *StateDiffTracer) OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+	t.touch(addr)
+	t.changes = append(t.changes, stateChange{addr: addr, slot: &slot, value: [2]common.Hash{prev, new}})
+}
+
+// touch reads the account before its first change, the hooks being called
+// before the state is modified. A nil entry means the account didn't exist.
+func (t *StateDiffTracer) touch(addr common.Address) {
+	if t.state == nil {
+		return
+	}
+	if _, ok := t.accounts[addr]; ok {
+		return
+	}
+	if !t.state.Exist(addr) {
+		t.accounts[addr] = nil
+		return
+	}
+	var (
+		nonce = t.state.GetNonce(addr)
+		code  = t.state.GetCode(addr)
+	)
+	account := &AccountState{
+		Balance: t.state.GetBalance(addr).ToBig(),
+		Nonce:   &nonce,
+	}
+	if len(code) > 0 {
+		codeHash := common.BytesToHash(crypto.Keccak256(code))
+		account.Code, account.CodeHash = code, &codeHash
+	}
+	t.accounts[addr] = account
+}
+
+// Result folds the recorded changes into the first and last value of every
+// field, leaving out the fields that ended up where they started.
+func (t *StateDiffTracer) Result() *StateDiff {
+	pre := make(map[common.Address]*AccountState)
+	post := make(map[common.Address]*AccountState)
+	account := func(m map[common.Address]*AccountState, addr common.Address) *AccountState {
+		if m[addr] == nil {
+			m[addr] = &AccountState{}
+		}
+		return m[addr]
+	}
+
+	for _, c := range t.changes {
+		before, after := account(pre, c.addr), account(post, c.addr)
+		switch {
+		case c.balance != nil:
+			if before.Balance == nil {
+				before.Balance = c.balance[0]
+			}
+			after.Balance = c.balance[1]
+		case c.nonce != nil:
+			if before.Nonce == nil {
+				before.Nonce = &c.nonce[0]
+			}
+			after.Nonce = &c.nonce[1]
+		case c.code != nil:
+			if before.CodeHash == nil {
+				before.CodeHash, before.Code = &c.code[0].hash, c.code[0].code
+			}
+			after.CodeHash, after.Code = &c.code[1].hash, c.code[1].code
+		case c.slot != nil:
+			if before.Storage == nil {
+				before.Storage = make(map[common.Hash]common.Hash)
+			}
+			if after.Storage == nil {
+				after.Storage = make(map[common.Hash]common.Hash)
+			}
+			if _, ok := before.Storage[*c.slot]; !ok {
+				before.Storage[*c.slot] = c.value[0]
+			}
+			after.Storage[*c.slot] = c.value[1]
+		}
+	}
+
+	diff := &StateDiff{
+		Pre:  make(map[common.Address]*AccountState),
+		Post: make(map[common.Address]*AccountState),
+	}
+	for addr, before := range pre {
+		after := post[addr]
+		dropUnchanged(before, after)
+		if isEmpty(after) {
+			continue
+		}
+		diff.Post[addr] = after
+
+		touched, ok := t.accounts[addr]
+		if ok && touched == nil {
+			// created by the transaction
+			continue
+		}
+		if ok {
+			if before.Balance == nil {
+				before.Balance = touched.Balance
+			}
+			if before.Nonce == nil {
+				before.Nonce = touched.Nonce
+			}
+			if before.CodeHash == nil {
+				before.CodeHash, before.Code = touched.CodeHash, touched.Code
+			}
+		}
+		diff.Pre[addr] = before
+	}
+	return diff
+}
+
+// MergeStateDiffs returns the diff of consecutive transactions from their own
+// diffs: the state before the first one that touched a field, and after the
+// last one.
+func MergeStateDiffs(diffs ...*StateDiff) *StateDiff {
+	pre := make(map[common.Address]*AccountState)
+	post := make(map[common.Address]*AccountState)
+	// accounts created by the transaction that first modified them
+	created := make(map[common.Address]bool)
+	for _, diff := range diffs {
+		for addr := range diff.Post {
+			if _, ok := post[addr]; !ok {
+				created[addr] = diff.Pre[addr] == nil
+			}
+		}
+		for addr, account := range diff.Pre {
+			if created[addr] {
+				continue
+			}
+			merged, ok := pre[addr]
+			if !ok {
+				merged = &AccountState{}
+				pre[addr] = merged
+			}
+			mergeAccount(merged, account, false)
+		}
+		for addr, account := range diff.Post {
+			merged, ok := post[addr]
+			if !ok {
+				merged = &AccountState{}
+				post[addr] = merged
+			}
+			mergeAccount(merged, account, true)
+		}
+	}
+
+	merged := &StateDiff{
+		Pre:  make(map[common.Address]*AccountState),
+		Post: make(map[common.Address]*AccountState),
+	}
+	for addr, after := range post {
+		before, existed := pre[addr]
+		if !existed {
+			before = &AccountState{}
+		}
+		existed = existed && !created[addr]
+		// unlike a single transaction, a field may have been set back to its
+		// value before the first one
+		for slot, value := range after.Storage {
+			if prev, ok := before.Storage[slot]; ok && prev == value {
+				delete(before.Storage, slot)
+				delete(after.Storage, slot)
+			}
+		}
+		if before.Balance != nil && after.Balance != nil && before.Balance.Cmp(after.Balance) == 0 {
+			after.Balance = nil
+		}
+		if before.Nonce != nil && after.Nonce != nil && *before.Nonce == *after.Nonce {
+			after.Nonce = nil
+		}
+		if before.CodeHash != nil && after.CodeHash != nil && *before.CodeHash == *after.CodeHash {
+			after.CodeHash, after.Code = nil, nil
+		}
+		if len(after.Storage) == 0 {
+			after.Storage = nil
+		}
+		if isEmpty(after) {
+			continue
+		}
+		merged.Post[addr] = after
+		if existed {
+			merged.Pre[addr] = before
+		}
+	}
+	return merged
+}
+
+// mergeAccount sets the fields of account into merged, keeping the ones
+// already set unless override.
+func mergeAccount(merged, account *AccountState, override bool) {
+	if account.Balance != nil && (override || merged.Balance == nil) {
+		merged.Balance = account.Balance
+	}
+	if account.Nonce != nil && (override || merged.Nonce == nil) {
+		merged.Nonce = account.Nonce
+	}
+	if account.CodeHash != nil && (override || merged.CodeHash == nil) {
+		merged.CodeHash, merged.Code = account.CodeHash, account.Code
+	}
+	for slot, value := range account.Storage {
+		if merged.Storage == nil {
+			merged.Storage = make(map[common.Hash]common.Hash)
+		}
+		if _, ok := merged.Storage[slot]; override || !ok {
+			merged.Storage[slot] = value
+		}
+	}
+}
+
+// dropUnchanged removes from both sides the fields that ended up where they
+// started.
+func dropUnchanged(before, after *AccountState) {
+	if before.Balance != nil && before.Balance.Cmp(after.Balance) == 0 {
+		before.Balance, after.Balance = nil, nil
+	}
+	if before.Nonce != nil && *before.Nonce == *after.Nonce {
+		before.Nonce, after.Nonce = nil, nil
+	}
+	if before.CodeHash != nil && *before.CodeHash == *after.CodeHash {
+		before.CodeHash, before.Code, after.CodeHash, after.Code = nil, nil, nil, nil
+	}
+	for slot, value := range before.Storage {
+		if after.Storage[slot] == value {
+			delete(before.Storage, slot)
+			delete(after.Storage, slot)
+		}
+	}
+	if len(before.Storage) == 0 {
+		before.Storage, after.Storage = nil, nil
+	}
+}
+
+func isEmpty(account *AccountState) bool {
+	return account.Balance == nil && account.Nonce == nil && account.CodeHash == nil && account.Storage == nil
+}
+
+func copyBig(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(v)
+}
@@ -0,0 +1,101 @@
+package evm_simulator
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestStateDiffTracer(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0xa1")
+		token = common.HexToAddress("0xb2")
+		slot  = common.HexToHash("0x01")
+	)
+	tracer := NewStateDiffTracer()
+
+	// first transaction, the nonce and the slot change
+	tracer.OnNonceChange(alice, 4, 5)
+	tracer.OnEnter(0, 0xf1, alice, token, nil, 0, new(big.Int))
+	tracer.OnStorageChange(token, slot, common.Hash{}, common.HexToHash("0x10"))
+	// reverted inner call
+	tracer.OnEnter(1, 0xf1, token, alice, nil, 0, big.NewInt(1))
+	tracer.OnBalanceChange(alice, big.NewInt(100), big.NewInt(101), tracing.BalanceChangeTransfer)
+	tracer.OnExit(1, nil, 0, nil, true)
+	tracer.OnExit(0, nil, 0, nil, false)
+
+	// second transaction, the slot goes back and changes again
+	tracer.OnNonceChange(alice, 5, 6)
+	tracer.OnEnter(0, 0xf1, alice, token, nil, 0, new(big.Int))
+	tracer.OnStorageChange(token, slot, common.HexToHash("0x10"), common.Hash{})
+	tracer.OnExit(0, nil, 0, nil, false)
+
+	diff := tracer.Result()
+	if diff.Pre[alice] == nil || *diff.Pre[alice].Nonce != 4 || *diff.Post[alice].Nonce != 6 {
+		t.Fatalf("nonce diff: have %+v -> %+v", diff.Pre[alice], diff.Post[alice])
+	}
+	if diff.Pre[alice].Balance != nil {
+		t.Fatalf("reverted balance change in the diff: %v", diff.Pre[alice].Balance)
+	}
+	if _, ok := diff.Pre[token]; ok {
+		t.Fatalf("unchanged slot in the diff: %+v", diff.Post[token])
+	}
+}
+
+func TestStateDiffExecution(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		origin   = common.HexToAddress("0xa1")
+		contract = common.HexToAddress("0xb2")
+		// SSTORE(0, 1)
+		code = []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x00}
+	)
+
+	diffs := make([]*StateDiff, 2)
+	for i := range diffs {
+		tracer := NewStateDiffTracer()
+		cfg := &runtime.Config{Origin: origin, GasLimit: 100000, IncrementNonce: true, EVMConfig: vmConfig(nil, tracer, nil)}
+		if _, err := runtime.Execute(contract, big.NewInt(1e18), code, nil, cfg, stateDB, nil); err != nil {
+			t.Fatal(err)
+		}
+		diffs[i] = tracer.Result()
+	}
+
+	second := diffs[1]
+	if second.Pre[origin] == nil || second.Pre[origin].Balance == nil || *second.Pre[origin].Nonce != 1 {
+		t.Fatalf("pre state of the origin not filled in: %+v", second.Pre[origin])
+	}
+	if second.Post[origin].Balance != nil || *second.Post[origin].Nonce != 2 {
+		t.Errorf("post state of the origin: %+v", second.Post[origin])
+	}
+	if _, ok := second.Post[contract]; ok {
+		t.Errorf("slot set to its own value in the diff: %+v", second.Post[contract])
+	}
+
+	merged := MergeStateDiffs(diffs...)
+	if merged.Pre[origin] == nil || *merged.Pre[origin].Nonce != 0 {
+		t.Errorf("merged pre state of the origin: %+v", merged.Pre[origin])
+	}
+	if *merged.Post[origin].Nonce != 2 || merged.Post[contract].Storage[common.Hash{}] != common.HexToHash("0x01") {
+		t.Errorf("merged post state: %+v %+v", merged.Post[origin], merged.Post[contract])
+	}
+
+	raw, err := json.Marshal(diffs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"pre":{"0x00000000000000000000000000000000000000a1":{"balance":"0xde0b6b3a7640000","nonce":1}},"post":{"0x00000000000000000000000000000000000000a1":{"nonce":2}}}`
+	if string(raw) != want {
+		t.Errorf("prestate JSON:\nhave %s\nwant %s", raw, want)
+	}
+}
@@ -0,0 +1,168 @@
+package evm_simulator
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+
+	"github.com/Arjxm/tracer/core/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// StructLoggerConfig selects what the StructLogger captures at every step,
+// memory and return data are off by default as they make the trace huge.
+type StructLoggerConfig struct {
+	EnableMemory     bool
+	DisableStack     bool
+	DisableStorage   bool
+	EnableReturnData bool
+}
+
+// structLog is an EIP-3155 trace line, the storage of the executing contract
+// known so far is added on SLOAD and SSTORE.
+type structLog struct {
+	Pc         uint64                      `json:"pc"`
+	Op         byte                        `json:"op"`
+	Gas        math.HexOrDecimal64         `json:"gas"`
+	GasCost    math.HexOrDecimal64         `json:"gasCost"`
+	Memory     hexutil.Bytes               `json:"memory,omitempty"`
+	MemorySize int                         `json:"memSize"`
+	Stack      *[]hexutil.U256             `json:"stack,omitempty"`
+	ReturnData hexutil.Bytes               `json:"returnData,omitempty"`
+	Storage    map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Depth      int                         `json:"depth"`
+	Refund     uint64                      `json:"refund"`
+	OpName     string                      `json:"opName"`
+	Err        string                      `json:"error,omitempty"`
+}
+
+// structLogSummary ends the trace of a transaction.
+type structLogSummary struct {
+	Output  string              `json:"output"`
+	GasUsed math.HexOrDecimal64 `json:"gasUsed"`
+	Err     string              `json:"error,omitempty"`
+}
+
+// StructLogger streams the steps of the EVM as EIP-3155 JSON lines, the same
+// as `evm --json` of geth. Only the storage slots read or written during the
+// transaction are kept, every SLOAD and SSTORE line holds the ones of its
+// contract. They are cleared by OnTxStart.
+type StructLogger struct {
+	cfg     StructLoggerConfig
+	encoder *json.Encoder
+	state   tracing.StateDB
+	// storage read or written by every contract in the current transaction
+	storage map[common.Address]map[common.Hash]common.Hash
+	err     error
+}
+
+func NewStructLogger(w io.Writer, cfg *StructLoggerConfig) *StructLogger {
+	logger := &StructLogger{
+		encoder: json.NewEncoder(w),
+		storage: make(map[common.Address]map[common.Hash]common.Hash),
+	}
+	if cfg != nil {
+		logger.cfg = *cfg
+	}
+	return logger
+}
+
+// Err returns the first error writing the trace.
+func (l *StructLogger) Err() error {
+	return l.err
+}
+
+func (l *StructLogger) OnTxStart(env *tracing.VMContext, tx *types.Transaction, from common.Address) {
+	l.state = env.StateDB
+	clear(l.storage)
+}
+
+func (l *StructLogger) OnOpcode(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, rData []byte, depth int, err error) {
+	memory := scope.MemoryData()
+	stack := scope.StackData()
+	line := structLog{
+		Pc:         pc,
+		Op:         op,
+		Gas:        math.HexOrDecimal64(gas),
+		GasCost:    math.HexOrDecimal64(cost),
+		MemorySize: len(memory),
+		Depth:      depth,
+		OpName:     evm.OpToString(op),
+	}
+	if l.state != nil {
+		line.Refund = l.state.GetRefund()
+	}
+	if err != nil {
+		line.Err = err.Error()
+	}
+	if l.cfg.EnableMemory {
+		line.Memory = common.CopyBytes(memory)
+	}
+	// an empty stack is written, a stack that isn't captured is left out
+	if !l.cfg.DisableStack {
+		values := make([]hexutil.U256, len(stack))
+		for i, v := range stack {
+			values[i] = hexutil.U256(v)
+		}
+		line.Stack = &values
+	}
+	if l.cfg.EnableReturnData {
+		line.ReturnData = common.CopyBytes(rData)
+	}
+	if !l.cfg.DisableStorage && l.captureStorage(evm.OpCode(op), scope) {
+		line.Storage = maps.Clone(l.storage[scope.Address()])
+	}
+	l.write(line)
+}
+
+// captureStorage records the slot accessed by an SLOAD or an SSTORE about to
+// execute, it reports whether op was one of them.
+func (l *StructLogger) captureStorage(op evm.OpCode, scope tracing.OpContext) bool {
+	stack := scope.StackData()
+	var key, value common.Hash
+	switch {
+	case op == evm.SLOAD && len(stack) >= 1 && l.state != nil:
+		key = stack[len(stack)-1].Bytes32()
+		value = l.state.GetState(scope.Address(), key)
+	case op == evm.SSTORE && len(stack) >= 2:
+		key, value = stack[len(stack)-1].Bytes32(), stack[len(stack)-2].Bytes32()
+	default:
+		return false
+	}
+	addr := scope.Address()
+	if l.storage[addr] == nil {
+		l.storage[addr] = make(map[common.Hash]common.Hash)
+	}
+	l.storage[addr][key] = value
+	return true
+}
+
+func (l *StructLogger) OnFault(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, depth int, err error) {
+	// geth writes the failing step again, with its error
+	l.OnOpcode(pc, op, gas, cost, scope, nil, depth, err)
+}
+
+func (l *StructLogger) OnExit(depth int, output []byte, gasUsed uint64, err error, reverted bool) {
+	if depth != 0 {
+		return
+	}
+	summary := structLogSummary{
+		Output:  common.Bytes2Hex(output),
+		GasUsed: math.HexOrDecimal64(gasUsed),
+	}
+	if err != nil {
+		summary.Err = err.Error()
+	}
+	l.write(summary)
+}
+
+func (l *StructLogger) write(v interface{}) {
+	if l.err != nil {
+		return
+	}
+	l.err = l.encoder.Encode(v)
+}
@@ -0,0 +1,48 @@
+package evm_simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestStructLogger(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		buf = new(bytes.Buffer)
+		// SSTORE(0, 1), STOP
+		code = []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x00}
+	)
+	logger := NewStructLogger(buf, &StructLoggerConfig{DisableStack: true})
+	cfg := &runtime.Config{Origin: common.HexToAddress("0xa1"), GasLimit: 100000, EVMConfig: vmConfig(nil, nil, logger)}
+	if _, err := runtime.Execute(common.HexToAddress("0xb2"), new(big.Int), code, nil, cfg, stateDB, nil); err != nil {
+		t.Fatal(err)
+	}
+	if logger.Err() != nil {
+		t.Fatal(logger.Err())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("have %d lines, want 4 steps and the summary:\n%s", len(lines), buf)
+	}
+	want := `{"pc":4,"op":85,"gas":"0x1869a","gasCost":"0x5654","memSize":0,"storage":{"0x0000000000000000000000000000000000000000000000000000000000000000":"0x0000000000000000000000000000000000000000000000000000000000000001"},"depth":1,"refund":0,"opName":"SSTORE"}`
+	if lines[2] != want {
+		t.Errorf("SSTORE step:\nhave %s\nwant %s", lines[2], want)
+	}
+	var summary structLogSummary
+	if err := json.Unmarshal([]byte(lines[4]), &summary); err != nil || summary.GasUsed != 22106 {
+		t.Errorf("summary: have %s", lines[4])
+	}
+}
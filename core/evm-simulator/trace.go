@@ -4,9 +4,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"github.com/Arjxm/tracer/core/decoder"
 	"github.com/Arjxm/tracer/core/evm"
+	"github.com/Arjxm/tracer/core/sourcemap"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
 	"math/big"
 )
 
@@ -14,7 +17,17 @@ type TracerEvent struct {
 	OnEnter  *OnEnterEvent
 	OpCodes  []*OpCodeEvent
 	Children []*TracerEvent
+	Logs     []*LogEvent
 	OnExit   *OnExitEvent
+	// Call is the decoded input and output of the frame, nil when its
+	// function isn't known
+	Call *decoder.DecodedCall
+	// Contract is the name of the compiled contract whose code the frame
+	// runs, empty when it isn't among the sources
+	Contract string
+
+	// code run by the frame, mapping its opcodes to their source
+	bytecode *sourcemap.Bytecode
 }
 
 type OnEnterEvent struct {
@@ -25,6 +38,9 @@ type OnEnterEvent struct {
 	Input string
 	Gas   uint64
 	Value *big.Int
+	// FromLabel and ToLabel name the addresses, empty when they are unknown
+	FromLabel string
+	ToLabel   string
 }
 
 type OpCodeEvent struct {
@@ -38,6 +54,38 @@ type OpCodeEvent struct {
 	Stack     []string
 	Memory    []string
 	ScopeData ScopeData
+	// Storage is the slot read by an SLOAD or written by an SSTORE
+	Storage *StorageAccess
+	// Source is the line of source the opcode was compiled from, nil when
+	// the contract isn't among the sources
+	Source *sourcemap.Location
+}
+
+// StorageAccess is a storage slot of the executing contract and its value,
+// the one loaded or the one stored when Write.
+type StorageAccess struct {
+	Slot  common.Hash
+	Value common.Hash
+	Write bool
+}
+
+// LogEvent is a log emitted by the frame of the TracerEvent holding it.
+type LogEvent struct {
+	Address common.Address
+	Topics  []string
+	Data    string
+	// Index is the position of the log within its frame, and Position the
+	// number of child calls the frame made before emitting it
+	Index    int
+	Position int
+	// GlobalIndex is the index of the log among the ones kept by its
+	// transaction, as in its receipt, it's -1 for a log discarded by a revert
+	GlobalIndex int
+	Discarded   bool
+	// Event is the decoded log, nil when its event isn't known
+	Event *decoder.DecodedEvent
+	// AddressLabel names the emitter, empty when it's unknown
+	AddressLabel string
 }
 
 type OnExitEvent struct {
@@ -46,6 +94,9 @@ type OnExitEvent struct {
 	GasUsed  uint64
 	Err      string
 	Reverted bool
+	// Revert is the decoded output of a reverted frame, nil when it reverted
+	// without reason
+	Revert *decoder.RevertReason
 }
 
 type ScopeData struct {
@@ -62,6 +113,22 @@ type CustomTracer struct {
 	CurrentEvents  []*TracerEvent
 	TraceCompleted bool
 	JSONData       []byte
+	// ABIs decode the calls, the logs and the custom errors of the reverted
+	// frames, may be nil
+	ABIs *decoder.Registry
+	// Opcodes records the steps of every frame in its OpCodes, they are left
+	// out otherwise as they are costly on long transactions
+	Opcodes bool
+	// Sources map the recorded opcodes back to the lines of source of the
+	// compiled contracts, may be nil
+	Sources *sourcemap.Sources
+
+	// logs of the running transaction in emission order, their global index
+	// is only known once its top level call exits
+	pendingLogs []*LogEvent
+	logCount    int
+	// state of the running transaction, read for the loaded storage slots
+	state tracing.StateDB
 }
 
 func NewCustomTracer() *CustomTracer {
@@ -71,6 +138,13 @@ func NewCustomTracer() *CustomTracer {
 	}
 }
 
+func (t *CustomTracer) OnTxStart(env *tracing.VMContext, tx *types.Transaction, from common.Address) {
+	t.state = env.StateDB
+	// logs are indexed within their transaction
+	t.logCount = 0
+	t.pendingLogs = t.pendingLogs[:0]
+}
+
 func (t *CustomTracer) OnEnter(depth int, typ byte, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
 	callType := evm.OpToString(typ)
 	event := &TracerEvent{
@@ -95,6 +169,7 @@ func (t *CustomTracer) OnEnter(depth int, typ byte, from common.Address, to comm
 	}
 
 	t.CurrentEvents = append(t.CurrentEvents, event)
+	t.matchSources(event, typ, to, input)
 
 	fmt.Printf("OnEnter: Depth: %d, Type: %s, From: %s, To: %s, Input: %x, Gas: %d, Value: %s\n", depth, callType, from.String(), to.String(), input, gas, value.String())
 }
@@ -110,14 +185,106 @@ func (t *CustomTracer) OnExit(depth int, output []byte, gasUsed uint64, err erro
 			Reverted: reverted,
 		}
 		t.CurrentEvents = t.CurrentEvents[:len(t.CurrentEvents)-1]
+		if reverted {
+			event.OnExit.Revert = decoder.DecodeRevert(output, event.OnEnter.To, t.ABIs)
+			discardLogs(event)
+		}
+		t.decodeCall(event, output)
+		if len(t.CurrentEvents) == 0 {
+			t.indexLogs()
+		}
 	}
 
 	fmt.Printf("OnExit: Depth: %d, Output: %x, GasUsed: %d, Err: %v, Reverted: %v\n", depth, output, gasUsed, err, reverted)
 }
 
+func (t *CustomTracer) OnLog(log *types.Log) {
+	if len(t.CurrentEvents) == 0 {
+		return
+	}
+	event := t.CurrentEvents[len(t.CurrentEvents)-1]
+
+	topics := make([]string, len(log.Topics))
+	for i, topic := range log.Topics {
+		topics[i] = topic.Hex()
+	}
+	logEvent := &LogEvent{
+		Address:     log.Address,
+		Topics:      topics,
+		Data:        fmt.Sprintf("%x", log.Data),
+		Index:       len(event.Logs),
+		Position:    len(event.Children),
+		GlobalIndex: -1,
+	}
+	if t.ABIs != nil {
+		logEvent.Event = decoder.DecodeLog(log.Address, log.Topics, log.Data, t.ABIs)
+	}
+	event.Logs = append(event.Logs, logEvent)
+	t.pendingLogs = append(t.pendingLogs, logEvent)
+}
+
+// matchSources looks for the compiled contract run by the frame of event, the
+// code of a creation being its input.
+func (t *CustomTracer) matchSources(event *TracerEvent, typ byte, to common.Address, input []byte) {
+	if t.Sources == nil {
+		return
+	}
+	switch evm.OpCode(typ) {
+	case evm.CREATE, evm.CREATE2:
+		event.bytecode = t.Sources.Match(input, true)
+	default:
+		if t.state == nil {
+			return
+		}
+		event.bytecode = t.Sources.Match(t.state.GetCode(to), false)
+	}
+	if event.bytecode != nil {
+		event.Contract = event.bytecode.Contract.Name
+	}
+}
+
+// decodeCall decodes the function called by a CALL-like frame, and what it
+// returned unless it reverted.
+func (t *CustomTracer) decodeCall(event *TracerEvent, output []byte) {
+	if t.ABIs == nil {
+		return
+	}
+	switch event.OnEnter.Type {
+	case evm.CALL.String(), evm.CALLCODE.String(), evm.DELEGATECALL.String(), evm.STATICCALL.String():
+	default:
+		return
+	}
+	if event.OnExit.Reverted {
+		output = nil
+	} else if output == nil {
+		output = []byte{}
+	}
+	event.Call = decoder.DecodeCall(decodeHex(event.OnEnter.Input), output, event.OnEnter.To, t.ABIs)
+}
+
+// indexLogs numbers the logs of the transaction that survived its reverts.
+func (t *CustomTracer) indexLogs() {
+	for _, log := range t.pendingLogs {
+		if !log.Discarded {
+			log.GlobalIndex = t.logCount
+			t.logCount++
+		}
+	}
+	t.pendingLogs = t.pendingLogs[:0]
+}
+
+// discardLogs flags the logs of a reverted frame, and of its children.
+func discardLogs(event *TracerEvent) {
+	for _, log := range event.Logs {
+		log.Discarded = true
+	}
+	for _, child := range event.Children {
+		discardLogs(child)
+	}
+}
+
 func (t *CustomTracer) OnOpcode(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, rData []byte, depth int, err error) {
 	opCode := evm.OpToString(op)
-	fmt.Println("OnOpcode: PC: ", pc, " OpCode: ", opCode, " Gas: ", gas, " Cost: ", cost, " Depth: ", depth, " Err: ", err)
 	if len(t.CurrentEvents) > 0 {
 		event := t.CurrentEvents[len(t.CurrentEvents)-1]
 
@@ -155,11 +322,27 @@ func (t *CustomTracer) OnOpcode(pc uint64, op byte, gas, cost uint64, scope trac
 			ScopeData: *scopeData,
 			Stack:     stackData,
 			Memory:    memoryData,
+			Storage:   t.storageAccess(evm.OpCode(op), scope),
+			Source:    event.bytecode.Locate(pc),
 		})
 	}
 
 }
 
+// storageAccess returns the slot accessed by an SLOAD or an SSTORE about to
+// execute, nil for the other opcodes.
+func (t *CustomTracer) storageAccess(op evm.OpCode, scope tracing.OpContext) *StorageAccess {
+	stack := scope.StackData()
+	switch {
+	case op == evm.SLOAD && len(stack) >= 1 && t.state != nil:
+		slot := common.Hash(stack[len(stack)-1].Bytes32())
+		return &StorageAccess{Slot: slot, Value: t.state.GetState(scope.Address(), slot)}
+	case op == evm.SSTORE && len(stack) >= 2:
+		return &StorageAccess{Slot: stack[len(stack)-1].Bytes32(), Value: stack[len(stack)-2].Bytes32(), Write: true}
+	}
+	return nil
+}
+
 func (t *CustomTracer) OnFault(pc uint64, op byte, gas, cost uint64, scope tracing.OpContext, depth int, err error) {
 	// Add your implementation here if needed
 }
@@ -0,0 +1,126 @@
+package evm_simulator
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Arjxm/tracer/core/evm/runtime"
+	"github.com/Arjxm/tracer/core/sourcemap"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCustomTracerLogs(t *testing.T) {
+	var (
+		tracer = NewCustomTracer()
+		token  = common.HexToAddress("0xb2")
+		topic  = common.HexToHash("0x01")
+	)
+	tracer.OnEnter(0, 0xf1, common.HexToAddress("0xa1"), token, nil, 0, new(big.Int))
+	tracer.OnLog(&types.Log{Address: token, Topics: []common.Hash{topic}})
+	tracer.OnEnter(1, 0xf1, token, token, nil, 0, new(big.Int))
+	tracer.OnLog(&types.Log{Address: token})
+	tracer.OnExit(1, nil, 0, nil, true)
+	tracer.OnLog(&types.Log{Address: token, Data: []byte{0x01}})
+	tracer.OnExit(0, nil, 0, nil, false)
+
+	top := tracer.Events[0]
+	if len(top.Logs) != 2 || len(top.Children[0].Logs) != 1 {
+		t.Fatalf("logs not attached to their frame: %d top, %d child", len(top.Logs), len(top.Children[0].Logs))
+	}
+	if discarded := top.Children[0].Logs[0]; !discarded.Discarded || discarded.GlobalIndex != -1 {
+		t.Errorf("log of reverted frame: have %+v", discarded)
+	}
+	if first, last := top.Logs[0], top.Logs[1]; first.GlobalIndex != 0 || last.GlobalIndex != 1 {
+		t.Errorf("global indexes: have %d, %d", first.GlobalIndex, last.GlobalIndex)
+	}
+	if last := top.Logs[1]; last.Index != 1 || last.Position != 1 || last.Data != "01" {
+		t.Errorf("position in frame: have %+v", last)
+	}
+
+	// the next transaction of a bundle counts its logs from zero
+	tracer.OnTxStart(&tracing.VMContext{}, nil, common.HexToAddress("0xa1"))
+	tracer.OnEnter(0, 0xf1, common.HexToAddress("0xa1"), token, nil, 0, new(big.Int))
+	tracer.OnLog(&types.Log{Address: token})
+	tracer.OnExit(0, nil, 0, nil, false)
+	if next := tracer.Events[1].Logs[0]; next.GlobalIndex != 0 {
+		t.Errorf("global index in the next transaction: have %d, want 0", next.GlobalIndex)
+	}
+}
+
+func TestCustomTracerOpcodes(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SSTORE(0, 1), MSTORE(0, SLOAD(0)), STOP
+	code := []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x60, 0x00, 0x54, 0x60, 0x00, 0x52, 0x00}
+	tracer := NewCustomTracer()
+	tracer.Opcodes = true
+	cfg := &runtime.Config{Origin: common.HexToAddress("0xa1"), GasLimit: 100000, EVMConfig: vmConfig(tracer, nil, nil)}
+	if _, err := runtime.Execute(common.HexToAddress("0xb2"), new(big.Int), code, nil, cfg, stateDB, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := tracer.Events[0].OpCodes
+	if len(ops) != 8 {
+		t.Fatalf("have %d steps, want 8", len(ops))
+	}
+	one := common.HexToHash("0x01")
+	if store := ops[2].Storage; ops[2].OpCode != "SSTORE" || store == nil || !store.Write || store.Value != one {
+		t.Errorf("SSTORE step: have %s %+v", ops[2].OpCode, store)
+	}
+	if load := ops[4].Storage; ops[4].OpCode != "SLOAD" || load == nil || load.Write || load.Value != one {
+		t.Errorf("SLOAD step: have %s %+v", ops[4].OpCode, load)
+	}
+	if top := ops[6].Stack[0]; top != "0x0" {
+		t.Errorf("MSTORE offset on top of the stack: have %s", top)
+	}
+	if memory := ops[7].Memory; len(memory) != 1 || memory[0] != "0x0000: "+one.Hex()[2:] {
+		t.Errorf("memory after MSTORE: have %v", memory)
+	}
+}
+
+// buildInfo is a Hardhat build-info of a contract running SSTORE(0, 1), STOP
+const buildInfo = `{
+	"input": {"sources": {"A.sol": {"content": "contract A {\n    uint x;\n    function f() public {\n        x = 1;\n    }\n}\n"}}},
+	"output": {
+		"contracts": {"A.sol": {"A": {"evm": {"deployedBytecode": {"object": "600160005500", "sourceMap": "59:5:0:-:0;;;25:48:0:o"}}}}},
+		"sources": {"A.sol": {"id": 0}}
+	}
+}`
+
+func TestCustomTracerSources(t *testing.T) {
+	stateDB, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "build-info.json")
+	if err := os.WriteFile(path, []byte(buildInfo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewCustomTracer()
+	tracer.Opcodes = true
+	tracer.Sources = sourcemap.NewSources()
+	if err := tracer.Sources.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &runtime.Config{Origin: common.HexToAddress("0xa1"), GasLimit: 100000, EVMConfig: vmConfig(tracer, nil, nil)}
+	code := []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x00}
+	if _, err := runtime.Execute(common.HexToAddress("0xb2"), new(big.Int), code, nil, cfg, stateDB, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	event := tracer.Events[0]
+	if event.Contract != "A" {
+		t.Fatalf("contract: have %q, want A", event.Contract)
+	}
+	if source := event.OpCodes[2].Source; source == nil || source.String() != "A.sol:4:9" || source.Text != "x = 1;" {
+		t.Errorf("SSTORE source: have %+v", source)
+	}
+}
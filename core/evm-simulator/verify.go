@@ -0,0 +1,105 @@
+package evm_simulator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ReceiptMismatch is a field of the receipt the simulation didn't reproduce.
+type ReceiptMismatch struct {
+	// Field is the path of the field in the receipt, e.g. logs[1].topics[0]
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (m ReceiptMismatch) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", m.Field, m.Expected, m.Actual)
+}
+
+// ReceiptVerification compares a simulated transaction with its receipt, the
+// replay was faithful when it has no mismatch.
+type ReceiptVerification struct {
+	Mismatches []ReceiptMismatch
+}
+
+func (v *ReceiptVerification) Ok() bool {
+	return len(v.Mismatches) == 0
+}
+
+func (v *ReceiptVerification) String() string {
+	if v.Ok() {
+		return "simulation matches the receipt"
+	}
+	lines := make([]string, len(v.Mismatches))
+	for i, m := range v.Mismatches {
+		lines[i] = m.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (v *ReceiptVerification) check(field string, expected, actual interface{}) {
+	e, a := fmt.Sprint(expected), fmt.Sprint(actual)
+	if e != a {
+		v.Mismatches = append(v.Mismatches, ReceiptMismatch{Field: field, Expected: e, Actual: a})
+	}
+}
+
+// verifyReceipt compares the status, gas used, logs and contract address of
+// the receipt returned by eth_getTransactionReceipt with the result.
+func verifyReceipt(receipt map[string]interface{}, result *TxSimulationResult) (*ReceiptVerification, error) {
+	verification := &ReceiptVerification{}
+
+	status, err := hexUint64(receipt, "status")
+	if err != nil {
+		return nil, err
+	}
+	simulatedStatus := types.ReceiptStatusSuccessful
+	if result.Err != nil {
+		simulatedStatus = types.ReceiptStatusFailed
+	}
+	verification.check("status", status, simulatedStatus)
+
+	gasUsed, err := hexUint64(receipt, "gasUsed")
+	if err != nil {
+		return nil, err
+	}
+	verification.check("gasUsed", gasUsed, result.GasUsed)
+
+	var contractAddress, simulatedAddress string
+	if addr, ok := receipt["contractAddress"].(string); ok {
+		contractAddress = common.HexToAddress(addr).Hex()
+	}
+	if result.ContractAddress != nil {
+		simulatedAddress = result.ContractAddress.Hex()
+	}
+	verification.check("contractAddress", contractAddress, simulatedAddress)
+
+	logs, _ := receipt["logs"].([]interface{})
+	verification.check("logs.length", len(logs), len(result.Logs))
+	for i := 0; i < len(logs) && i < len(result.Logs); i++ {
+		log, ok := logs[i].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid log %d in receipt", i)
+		}
+		simulated := result.Logs[i]
+
+		address, _ := log["address"].(string)
+		verification.check(fmt.Sprintf("logs[%d].address", i), common.HexToAddress(address).Hex(), simulated.Address.Hex())
+
+		topics, _ := log["topics"].([]interface{})
+		verification.check(fmt.Sprintf("logs[%d].topics.length", i), len(topics), len(simulated.Topics))
+		for j := 0; j < len(topics) && j < len(simulated.Topics); j++ {
+			topic, _ := topics[j].(string)
+			verification.check(fmt.Sprintf("logs[%d].topics[%d]", i, j), common.HexToHash(topic).Hex(), simulated.Topics[j].Hex())
+		}
+
+		data, _ := log["data"].(string)
+		verification.check(fmt.Sprintf("logs[%d].data", i), strings.ToLower(data), hexutil.Encode(simulated.Data))
+	}
+	return verification, nil
+}
@@ -0,0 +1,60 @@
+package evm_simulator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestVerifyReceipt(t *testing.T) {
+	receipt := map[string]interface{}{
+		"status":          "0x1",
+		"gasUsed":         "0x5208",
+		"contractAddress": nil,
+		"logs": []interface{}{
+			map[string]interface{}{
+				"address": "0x00000000000000000000000000000000000000b2",
+				"topics":  []interface{}{"0x0000000000000000000000000000000000000000000000000000000000000001"},
+				"data":    "0x02",
+			},
+		},
+	}
+	result := &TxSimulationResult{
+		GasUsed: 21000,
+		Logs: []*types.Log{{
+			Address: common.HexToAddress("0xb2"),
+			Topics:  []common.Hash{common.HexToHash("0x01")},
+			Data:    []byte{0x02},
+		}},
+	}
+
+	verification, err := verifyReceipt(receipt, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Ok() {
+		t.Fatalf("faithful replay reported as mismatching:\n%s", verification)
+	}
+
+	result.Err = errors.New("execution reverted")
+	result.GasUsed = 21001
+	result.Logs[0].Data = []byte{0x03}
+	verification, err = verifyReceipt(receipt, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]bool)
+	for _, m := range verification.Mismatches {
+		fields[m.Field] = true
+	}
+	for _, field := range []string{"status", "gasUsed", "logs[0].data"} {
+		if !fields[field] {
+			t.Errorf("mismatch of %s not reported: %v", field, verification.Mismatches)
+		}
+	}
+	if len(verification.Mismatches) != 3 {
+		t.Errorf("unexpected mismatches: %v", verification.Mismatches)
+	}
+}
@@ -110,7 +110,7 @@ type EVM struct {
 	Context BlockContext
 	TxContext
 	// StateDB gives access to the underlying state
-	StateDB *state.StateDB
+	StateDB StateDB
 	// Depth is the current call stack
 	depth int
 
@@ -137,11 +137,9 @@ type EVM struct {
 func NewEVM(
 	blockCtx BlockContext,
 	txCtx TxContext,
-	record *RecordToInitiateState,
-	statedb *state.StateDB,
+	statedb StateDB,
 	chainConfig *params.ChainConfig,
 	config vm.Config,
-	chainId uint64,
 ) *EVM {
 	// If basefee tracking is disabled (eth_call, eth_estimateGas, etc), and no
 	// gas prices were specified, lower the basefee to 0 to avoid breaking EVM
@@ -162,13 +160,13 @@ func NewEVM(
 		chainConfig: chainConfig,
 		chainRules:  chainConfig.Rules(blockCtx.BlockNumber, blockCtx.Random != nil, blockCtx.Time),
 	}
-	evm.interpreter = NewEVMInterpreter(evm, record, chainId)
+	evm.interpreter = NewEVMInterpreter(evm)
 	return evm
 }
 
 // Reset resets the EVM with a new transaction context.Reset
 // This is not threadsafe and should only be done very cautiously.
-func (evm *EVM) Reset(txCtx TxContext, statedb *state.StateDB) {
+func (evm *EVM) Reset(txCtx TxContext, statedb StateDB) {
 	if evm.chainRules.IsEIP4762 {
 		txCtx.AccessEvents = state.NewAccessEvents(statedb.PointCache())
 	}
@@ -0,0 +1,446 @@
+package evm
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// ForkStateSource provides the chain state the simulation is forked from.
+// Implementations are bound to a single block, every value returned must
+// be the one found at that block.
+type ForkStateSource interface {
+	GetCode(addr common.Address) ([]byte, error)
+	GetBalance(addr common.Address) (*uint256.Int, error)
+	GetNonce(addr common.Address) (uint64, error)
+	GetStorageAt(addr common.Address, slot common.Hash) (common.Hash, error)
+	// GetStorageRoot returns the storage root of addr, the empty root when
+	// it has no storage
+	GetStorageRoot(addr common.Address) (common.Hash, error)
+	GetBlockHash(number uint64) (common.Hash, error)
+}
+
+// forkLoad is a value copied from the fork source into the underlying state,
+// kept around so it can be copied again if the journal reverts it.
+type forkLoad func(*state.StateDB)
+
+// ForkedStateDB wraps a state.StateDB and populates it from a ForkStateSource
+// the first time an account field or storage slot is touched. Loaded values
+// are tracked in the same sets as RecordToInitiateState, so anything already
+// marked there (by a previous run or by an override) is never fetched.
+type ForkedStateDB struct {
+	*state.StateDB
+	source ForkStateSource
+	logger *tracing.Hooks
+
+	addressCodeSet    map[common.Address]struct{}
+	addressBalanceSet map[common.Address]struct{}
+	addressNonceSet   map[common.Address]struct{}
+	// key should be address:key
+	addressStorageSet map[string]common.Hash
+
+	// accounts whose storage must not be fetched, as it was created or
+	// wiped during the simulation, or overridden
+	localStorage map[common.Address]struct{}
+	// accounts that called SELFDESTRUCT, checked again on Finalise in case
+	// the call reverted
+	selfDestructed map[common.Address]struct{}
+	// forked values of slots loaded since the last Finalise, the underlying
+	// state only sees them as dirty so it can't report them as committed
+	pendingOrigin map[string]common.Hash
+	// storage roots of the forked accounts, only read to tell whether they
+	// have storage
+	storageRoots map[common.Address]common.Hash
+
+	loads     []forkLoad
+	snapLoads map[int]int
+
+	err error
+}
+
+// NewForkedStateDB returns a ForkedStateDB on top of db. A nil source
+// disables fetching and makes the wrapper a plain pass-through.
+func NewForkedStateDB(db *state.StateDB, source ForkStateSource, record *RecordToInitiateState) *ForkedStateDB {
+	s := &ForkedStateDB{
+		StateDB:        db,
+		source:         source,
+		localStorage:   make(map[common.Address]struct{}),
+		selfDestructed: make(map[common.Address]struct{}),
+		pendingOrigin:  make(map[string]common.Hash),
+		storageRoots:   make(map[common.Address]common.Hash),
+		snapLoads:      make(map[int]int),
+	}
+	if record != nil {
+		s.addressCodeSet = record.AddressCodeSet
+		s.addressBalanceSet = record.AddressBalanceSet
+		s.addressNonceSet = record.AddressNonceSet
+		s.addressStorageSet = record.AddressStorageSet
+		if record.AddressLocalStorageSet != nil {
+			s.localStorage = record.AddressLocalStorageSet
+		}
+	}
+	if s.addressCodeSet == nil {
+		s.addressCodeSet = make(map[common.Address]struct{})
+	}
+	if s.addressBalanceSet == nil {
+		s.addressBalanceSet = make(map[common.Address]struct{})
+	}
+	if s.addressNonceSet == nil {
+		s.addressNonceSet = make(map[common.Address]struct{})
+	}
+	if s.addressStorageSet == nil {
+		s.addressStorageSet = make(map[string]common.Hash)
+	}
+	return s
+}
+
+// Error returns the first error hit while fetching from the fork source,
+// or the error of the underlying state.
+func (s *ForkedStateDB) Error() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.StateDB.Error()
+}
+
+// SetLogger sets the hooks for account updates. Values copied from the fork
+// are not changes made by the simulation, so they are never reported.
+func (s *ForkedStateDB) SetLogger(l *tracing.Hooks) {
+	s.logger = l
+	s.StateDB.SetLogger(l)
+}
+
+func (s *ForkedStateDB) MarkAddressCode(addr common.Address) {
+	s.addressCodeSet[addr] = struct{}{}
+}
+
+func (s *ForkedStateDB) MarkAddressBalance(addr common.Address) {
+	s.addressBalanceSet[addr] = struct{}{}
+}
+
+func (s *ForkedStateDB) MarkAddressNonce(addr common.Address) {
+	s.addressNonceSet[addr] = struct{}{}
+}
+
+func (s *ForkedStateDB) MarkAddressStorage(addr common.Address, slot common.Hash, value common.Hash) {
+	s.addressStorageSet[storageKey(addr, slot)] = value
+}
+
+// MarkAddressLocalStorage stops fetching any slot of addr, its storage being
+// entirely defined by the simulation.
+func (s *ForkedStateDB) MarkAddressLocalStorage(addr common.Address) {
+	s.localStorage[addr] = struct{}{}
+}
+
+// GetRecordToInitState returns the sets of everything fetched so far, to be
+// handed to the next run on the same state.
+func (s *ForkedStateDB) GetRecordToInitState() *RecordToInitiateState {
+	return &RecordToInitiateState{
+		AddressCodeSet:    s.addressCodeSet,
+		AddressBalanceSet: s.addressBalanceSet,
+		AddressNonceSet:   s.addressNonceSet,
+		AddressStorageSet: s.addressStorageSet,
+
+		AddressLocalStorageSet: s.localStorage,
+	}
+}
+
+func storageKey(addr common.Address, slot common.Hash) string {
+	return addr.Hex() + ":" + slot.Hex()
+}
+
+func (s *ForkedStateDB) setError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// apply copies a forked value into the underlying state without reporting it
+// to the logger, and remembers it in case a revert drops it.
+func (s *ForkedStateDB) apply(load forkLoad) {
+	s.StateDB.SetLogger(nil)
+	load(s.StateDB)
+	s.StateDB.SetLogger(s.logger)
+	s.loads = append(s.loads, load)
+}
+
+// loadAccount fetches every field of addr not loaded yet. The missing fields
+// are fetched concurrently since an account is usually touched as a whole.
+func (s *ForkedStateDB) loadAccount(addr common.Address) {
+	if s.source == nil {
+		return
+	}
+	_, codeSet := s.addressCodeSet[addr]
+	_, balanceSet := s.addressBalanceSet[addr]
+	_, nonceSet := s.addressNonceSet[addr]
+	if codeSet && balanceSet && nonceSet {
+		return
+	}
+
+	var (
+		code    []byte
+		balance *uint256.Int
+		nonce   uint64
+		errs    [3]error
+		wg      sync.WaitGroup
+	)
+	if !codeSet {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, errs[0] = s.source.GetCode(addr)
+		}()
+	}
+	if !balanceSet {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			balance, errs[1] = s.source.GetBalance(addr)
+		}()
+	}
+	if !nonceSet {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, errs[2] = s.source.GetNonce(addr)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			s.setError(err)
+			return
+		}
+	}
+
+	if !codeSet {
+		s.addressCodeSet[addr] = struct{}{}
+		if len(code) > 0 {
+			s.apply(func(db *state.StateDB) { db.SetCode(addr, code) })
+		}
+	}
+	if !balanceSet {
+		s.addressBalanceSet[addr] = struct{}{}
+		if balance != nil && !balance.IsZero() {
+			// the balance may have moved already (e.g. a transfer into a
+			// not yet loaded account), so add the forked one on top
+			s.apply(func(db *state.StateDB) { db.AddBalance(addr, balance, tracing.BalanceChangeUnspecified) })
+		}
+	}
+	if !nonceSet {
+		s.addressNonceSet[addr] = struct{}{}
+		if nonce > 0 {
+			s.apply(func(db *state.StateDB) { db.SetNonce(addr, nonce) })
+		}
+	}
+}
+
+// loadSlot fetches the value of slot in addr if it was not loaded yet.
+func (s *ForkedStateDB) loadSlot(addr common.Address, slot common.Hash) {
+	if s.source == nil {
+		return
+	}
+	if _, ok := s.localStorage[addr]; ok {
+		return
+	}
+	key := storageKey(addr, slot)
+	if _, ok := s.addressStorageSet[key]; ok {
+		return
+	}
+	s.loadAccount(addr)
+
+	value, err := s.source.GetStorageAt(addr, slot)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.addressStorageSet[key] = value
+	if value != (common.Hash{}) {
+		s.pendingOrigin[key] = value
+		s.apply(func(db *state.StateDB) { db.SetState(addr, slot, value) })
+	}
+}
+
+func (s *ForkedStateDB) Exist(addr common.Address) bool {
+	s.loadAccount(addr)
+	return s.StateDB.Exist(addr)
+}
+
+func (s *ForkedStateDB) Empty(addr common.Address) bool {
+	s.loadAccount(addr)
+	return s.StateDB.Empty(addr)
+}
+
+func (s *ForkedStateDB) GetBalance(addr common.Address) *uint256.Int {
+	s.loadAccount(addr)
+	return s.StateDB.GetBalance(addr)
+}
+
+func (s *ForkedStateDB) AddBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) {
+	s.loadAccount(addr)
+	s.StateDB.AddBalance(addr, amount, reason)
+}
+
+func (s *ForkedStateDB) SubBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) {
+	s.loadAccount(addr)
+	s.StateDB.SubBalance(addr, amount, reason)
+}
+
+func (s *ForkedStateDB) SetBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) {
+	s.loadAccount(addr)
+	s.StateDB.SetBalance(addr, amount, reason)
+}
+
+func (s *ForkedStateDB) GetNonce(addr common.Address) uint64 {
+	s.loadAccount(addr)
+	return s.StateDB.GetNonce(addr)
+}
+
+func (s *ForkedStateDB) SetNonce(addr common.Address, nonce uint64) {
+	s.loadAccount(addr)
+	s.StateDB.SetNonce(addr, nonce)
+}
+
+func (s *ForkedStateDB) GetCode(addr common.Address) []byte {
+	s.loadAccount(addr)
+	return s.StateDB.GetCode(addr)
+}
+
+func (s *ForkedStateDB) GetCodeSize(addr common.Address) int {
+	s.loadAccount(addr)
+	return s.StateDB.GetCodeSize(addr)
+}
+
+func (s *ForkedStateDB) GetCodeHash(addr common.Address) common.Hash {
+	s.loadAccount(addr)
+	return s.StateDB.GetCodeHash(addr)
+}
+
+func (s *ForkedStateDB) SetCode(addr common.Address, code []byte) {
+	s.loadAccount(addr)
+	s.StateDB.SetCode(addr, code)
+}
+
+func (s *ForkedStateDB) GetState(addr common.Address, slot common.Hash) common.Hash {
+	s.loadSlot(addr, slot)
+	return s.StateDB.GetState(addr, slot)
+}
+
+func (s *ForkedStateDB) GetCommittedState(addr common.Address, slot common.Hash) common.Hash {
+	s.loadSlot(addr, slot)
+	if _, ok := s.localStorage[addr]; !ok {
+		if value, ok := s.pendingOrigin[storageKey(addr, slot)]; ok {
+			return value
+		}
+	}
+	return s.StateDB.GetCommittedState(addr, slot)
+}
+
+func (s *ForkedStateDB) SetState(addr common.Address, slot common.Hash, value common.Hash) {
+	s.loadSlot(addr, slot)
+	s.StateDB.SetState(addr, slot, value)
+}
+
+// GetStorageRoot returns the storage root of the forked account when the
+// simulation didn't define its storage, so that an account having storage
+// only on chain still collides with a contract created at its address.
+func (s *ForkedStateDB) GetStorageRoot(addr common.Address) common.Hash {
+	s.loadAccount(addr)
+	root := s.StateDB.GetStorageRoot(addr)
+	if s.source == nil || root != (common.Hash{}) && root != types.EmptyRootHash {
+		return root
+	}
+	if _, ok := s.localStorage[addr]; ok {
+		return root
+	}
+	forked, ok := s.storageRoots[addr]
+	if !ok {
+		var err error
+		if forked, err = s.source.GetStorageRoot(addr); err != nil {
+			s.setError(err)
+			return root
+		}
+		s.storageRoots[addr] = forked
+	}
+	if forked == (common.Hash{}) {
+		return root
+	}
+	return forked
+}
+
+func (s *ForkedStateDB) CreateAccount(addr common.Address) {
+	s.loadAccount(addr)
+	s.StateDB.CreateAccount(addr)
+	s.localStorage[addr] = struct{}{}
+}
+
+func (s *ForkedStateDB) CreateContract(addr common.Address) {
+	s.loadAccount(addr)
+	s.StateDB.CreateContract(addr)
+	s.localStorage[addr] = struct{}{}
+}
+
+func (s *ForkedStateDB) SelfDestruct(addr common.Address) {
+	s.loadAccount(addr)
+	s.StateDB.SelfDestruct(addr)
+	s.selfDestructed[addr] = struct{}{}
+}
+
+func (s *ForkedStateDB) Selfdestruct6780(addr common.Address) {
+	s.loadAccount(addr)
+	s.StateDB.Selfdestruct6780(addr)
+}
+
+func (s *ForkedStateDB) HasSelfDestructed(addr common.Address) bool {
+	s.loadAccount(addr)
+	return s.StateDB.HasSelfDestructed(addr)
+}
+
+func (s *ForkedStateDB) Snapshot() int {
+	id := s.StateDB.Snapshot()
+	s.snapLoads[id] = len(s.loads)
+	return id
+}
+
+// RevertToSnapshot reverts the underlying state and copies back every forked
+// value loaded after the snapshot, since they were never part of the changes
+// being reverted.
+func (s *ForkedStateDB) RevertToSnapshot(id int) {
+	s.StateDB.RevertToSnapshot(id)
+
+	from, ok := s.snapLoads[id]
+	if !ok {
+		return
+	}
+	s.StateDB.SetLogger(nil)
+	for _, load := range s.loads[from:] {
+		load(s.StateDB)
+	}
+	s.StateDB.SetLogger(s.logger)
+	for snap := range s.snapLoads {
+		if snap >= id {
+			delete(s.snapLoads, snap)
+		}
+	}
+}
+
+// Finalise finalises the underlying state. Loaded slots become committed
+// there and self-destructed accounts lose their forked storage.
+func (s *ForkedStateDB) Finalise(deleteEmptyObjects bool) {
+	for addr := range s.selfDestructed {
+		if s.StateDB.HasSelfDestructed(addr) {
+			s.localStorage[addr] = struct{}{}
+		}
+	}
+	s.StateDB.Finalise(deleteEmptyObjects)
+
+	clear(s.selfDestructed)
+	clear(s.pendingOrigin)
+	clear(s.snapLoads)
+	s.loads = s.loads[:0]
+}
@@ -0,0 +1,164 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+type mapSource struct {
+	code    map[common.Address][]byte
+	balance map[common.Address]*uint256.Int
+	storage map[common.Address]map[common.Hash]common.Hash
+	calls   int
+}
+
+func (m *mapSource) GetCode(addr common.Address) ([]byte, error) {
+	m.calls++
+	return m.code[addr], nil
+}
+
+func (m *mapSource) GetBalance(addr common.Address) (*uint256.Int, error) {
+	m.calls++
+	if b, ok := m.balance[addr]; ok {
+		return b, nil
+	}
+	return new(uint256.Int), nil
+}
+
+func (m *mapSource) GetNonce(addr common.Address) (uint64, error) {
+	m.calls++
+	return 0, nil
+}
+
+func (m *mapSource) GetStorageAt(addr common.Address, slot common.Hash) (common.Hash, error) {
+	m.calls++
+	return m.storage[addr][slot], nil
+}
+
+func (m *mapSource) GetStorageRoot(addr common.Address) (common.Hash, error) {
+	m.calls++
+	if len(m.storage[addr]) == 0 {
+		return types.EmptyRootHash, nil
+	}
+	// any root but the empty one
+	return common.HexToHash("0x5707a9e"), nil
+}
+
+func (m *mapSource) GetBlockHash(number uint64) (common.Hash, error) {
+	return common.Hash{}, nil
+}
+
+func TestForkedStateDB(t *testing.T) {
+	var (
+		addr  = common.HexToAddress("0x01")
+		slot  = common.HexToHash("0x02")
+		value = common.HexToHash("0x03")
+	)
+	source := &mapSource{
+		code:    map[common.Address][]byte{addr: {0x00}},
+		balance: map[common.Address]*uint256.Int{addr: uint256.NewInt(10)},
+		storage: map[common.Address]map[common.Hash]common.Hash{addr: {slot: value}},
+	}
+	inner, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewForkedStateDB(inner, source, nil)
+
+	// loads happening inside a reverted frame must survive the revert
+	snap := db.Snapshot()
+	if got := db.GetState(addr, slot); got != value {
+		t.Fatalf("storage not forked: have %x, want %x", got, value)
+	}
+	db.SetState(addr, slot, common.Hash{})
+	db.AddBalance(addr, uint256.NewInt(5), tracing.BalanceChangeTransfer)
+	db.RevertToSnapshot(snap)
+
+	if got := db.GetState(addr, slot); got != value {
+		t.Fatalf("forked storage lost on revert: have %x, want %x", got, value)
+	}
+	if got := db.GetBalance(addr); got.Uint64() != 10 {
+		t.Fatalf("forked balance lost on revert: have %d, want 10", got.Uint64())
+	}
+
+	db.SetState(addr, slot, common.Hash{})
+	if got := db.GetCommittedState(addr, slot); got != value {
+		t.Fatalf("committed state not forked: have %x, want %x", got, value)
+	}
+
+	calls := source.calls
+	db.GetCode(addr)
+	db.GetState(addr, slot)
+	if source.calls != calls {
+		t.Fatalf("source queried again for loaded values")
+	}
+	if err := db.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForkedStateDBStorageRoot(t *testing.T) {
+	var (
+		stored  = common.HexToAddress("0x01")
+		empty   = common.HexToAddress("0x02")
+		created = common.HexToAddress("0x03")
+	)
+	source := &mapSource{
+		storage: map[common.Address]map[common.Hash]common.Hash{
+			stored:  {common.HexToHash("0x01"): common.HexToHash("0x01")},
+			created: {common.HexToHash("0x01"): common.HexToHash("0x01")},
+		},
+	}
+	inner, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewForkedStateDB(inner, source, nil)
+
+	// an account with storage on chain only must collide with a creation
+	if root := db.GetStorageRoot(stored); root == (common.Hash{}) || root == types.EmptyRootHash {
+		t.Errorf("forked storage root: have %x", root)
+	}
+	calls := source.calls
+	db.GetStorageRoot(stored)
+	if source.calls != calls {
+		t.Errorf("source queried again for the storage root")
+	}
+	if root := db.GetStorageRoot(empty); root != (common.Hash{}) && root != types.EmptyRootHash {
+		t.Errorf("empty storage root: have %x", root)
+	}
+	// a contract created over the forked storage collides
+	deployer := common.HexToAddress("0xa1")
+	source.storage[crypto.CreateAddress(deployer, 0)] = map[common.Hash]common.Hash{{}: common.HexToHash("0x01")}
+	blockCtx := BlockContext{
+		CanTransfer: func(StateDB, common.Address, *uint256.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *uint256.Int) {},
+		BlockNumber: new(big.Int),
+		Difficulty:  new(big.Int),
+		Random:      &common.Hash{},
+	}
+	vmenv := NewEVM(blockCtx, TxContext{Origin: deployer}, db, params.MergedTestChainConfig, vm.Config{})
+	if _, _, _, err := vmenv.Create(AccountRef(deployer), nil, 100000, new(uint256.Int)); !errors.Is(err, ErrContractAddressCollision) {
+		t.Errorf("create over forked storage: have %v, want %v", err, ErrContractAddressCollision)
+	}
+
+	// the storage of an account created by the simulation isn't forked
+	db.CreateAccount(created)
+	if root := db.GetStorageRoot(created); root != (common.Hash{}) && root != types.EmptyRootHash {
+		t.Errorf("created account storage root: have %x", root)
+	}
+	if err := db.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
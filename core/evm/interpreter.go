@@ -17,9 +17,7 @@
 package evm
 
 import (
-	"errors"
 	"fmt"
-	"github.com/Arjxm/tracer/core/rpc"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
@@ -80,9 +78,8 @@ func (ctx *ScopeContext) CallInput() []byte {
 
 // EVMInterpreter represents an EVM interpreter
 type EVMInterpreter struct {
-	rpcClt *rpc.Client
-	evm    *EVM
-	table  *JumpTable
+	evm   *EVM
+	table *JumpTable
 
 	hasher    crypto.KeccakState // Keccak256 hasher instance shared across opcodes
 	hasherBuf common.Hash        // Keccak256 hasher result array shared across opcodes
@@ -90,12 +87,7 @@ type EVMInterpreter struct {
 	readOnly   bool   // Whether to throw on stateful modifications
 	returnData []byte // Last CALL's return data for subsequent reuse
 
-	// map to track when a address code was set, to avoid fetching again from fork
-	// TODO: this is ugly think in to refactor
-	addressCodeSet    map[common.Address]struct{}
-	addressBalanceSet map[common.Address]struct{}
-	// key should be address:key
-	addressStorageSet        map[string]common.Hash
+	// slots already appended to the access list, keyed by address:slot
 	addressSlotAccessListSet map[string]struct{}
 	// access list
 	accessList types.AccessList
@@ -105,15 +97,18 @@ type RecordToInitiateState struct {
 	// map to track when a address code was set, to avoid fetching again from fork
 	AddressCodeSet    map[common.Address]struct{}
 	AddressBalanceSet map[common.Address]struct{}
+	AddressNonceSet   map[common.Address]struct{}
 	// key should be address:key
 	AddressStorageSet map[string]common.Hash
+	// accounts whose storage is not forked at all, any slot missing in
+	// AddressStorageSet is empty
+	AddressLocalStorageSet map[common.Address]struct{}
 	// access list
 	AccessList types.AccessList
 }
 
 // NewEVMInterpreter returns a new instance of the Interpreter.
-func NewEVMInterpreter(evm *EVM, record *RecordToInitiateState, chainId uint64) *EVMInterpreter {
-	rpcClt := rpc.NewClient(chainId)
+func NewEVMInterpreter(evm *EVM) *EVMInterpreter {
 	// If jump table was not initialised we set the default one.
 	var table *JumpTable
 	switch {
@@ -159,48 +154,17 @@ func NewEVMInterpreter(evm *EVM, record *RecordToInitiateState, chainId uint64)
 		}
 	}
 	evm.Config.ExtraEips = extraEips
-	interpreter := &EVMInterpreter{
-		rpcClt: rpcClt,
-		evm:    evm,
-		table:  table,
+	return &EVMInterpreter{
+		evm:                      evm,
+		table:                    table,
+		addressSlotAccessListSet: make(map[string]struct{}),
 	}
-
-	if record != nil {
-		interpreter.addressCodeSet = record.AddressCodeSet
-		interpreter.addressBalanceSet = record.AddressBalanceSet
-		interpreter.addressStorageSet = record.AddressStorageSet
-	} else {
-		interpreter.addressCodeSet = make(map[common.Address]struct{})
-		interpreter.addressBalanceSet = make(map[common.Address]struct{})
-		interpreter.addressStorageSet = make(map[string]common.Hash)
-	}
-
-	interpreter.addressSlotAccessListSet = make(map[string]struct{})
-
-	return interpreter
-}
-
-func (in *EVMInterpreter) MarkAddressCode(addr common.Address) {
-	in.addressCodeSet[addr] = struct{}{}
-}
-
-func (in *EVMInterpreter) MarkAddressBalance(addr common.Address) {
-	in.addressBalanceSet[addr] = struct{}{}
 }
 
 func (in *EVMInterpreter) AccessList() types.AccessList {
 	return in.accessList
 }
 
-func (in *EVMInterpreter) GetRecordToInitState() *RecordToInitiateState {
-	return &RecordToInitiateState{
-		AddressCodeSet:    in.addressCodeSet,
-		AddressBalanceSet: in.addressBalanceSet,
-		AddressStorageSet: in.addressStorageSet,
-		AccessList:        in.accessList,
-	}
-}
-
 // Run loops and evaluates the contract's code with the given input data and returns
 // the return byte-slice and an error if one occurred.
 //
@@ -290,27 +254,6 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// Get the operation from the jump table and validate the stack to ensure there are
 		// enough stack items available to perform the operation.
 		op = contract.GetOp(pc)
-		fmt.Println("op", op, in.evm.Context.BlockNumber)
-		switch {
-
-		case readStorage(op):
-			// register address code if needed
-			err = in.registerAddressStorage(op, callContext, "0x"+in.evm.Context.BlockNumber.Text(16))
-			if err != nil {
-				return nil, err
-			}
-		case isCall(op):
-			err = in.registerAddressCodeForCalls(op, callContext, "0x"+in.evm.Context.BlockNumber.Text(16))
-			if err != nil {
-				return nil, err
-			}
-		case isExtCode(op):
-			err = in.registerAddressCodeForExt(op, callContext, "0x"+in.evm.Context.BlockNumber.Text(16))
-			if err != nil {
-				return nil, err
-			}
-		}
-
 		if interactWithStorage(op) {
 			in.appendToAccessList(op, callContext)
 		}
@@ -395,165 +338,10 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	return res, err
 }
 
-func readStorage(op OpCode) bool {
-	return op == SLOAD
-}
-
 func interactWithStorage(op OpCode) bool {
 	return op == SLOAD || op == SSTORE
 }
 
-func isCall(op OpCode) bool {
-	return op == CALL || op == CALLCODE || op == DELEGATECALL || op == STATICCALL
-}
-
-func isExtCode(op OpCode) bool {
-	return op == EXTCODECOPY || op == EXTCODEHASH || op == EXTCODESIZE
-}
-
-// registerAddressCodeForCalls in case the opcode will be
-// CALL, CALLCODE, DELEGATECALL, or STATICCALL
-// we will try to fetch the address code
-// that will be requested this opcodes on the current blocknumber
-// and register that code in the evm state.
-// TODO: use cache to avoid double requesting Http
-func (in *EVMInterpreter) registerAddressCodeForCalls(op OpCode, scope *ScopeContext, blk string) error {
-	if len(scope.StackData()) < 3 {
-		return errors.New("insufficient elements in stack")
-	}
-
-	// copy data in stack
-	stackTmp := make([]uint256.Int, len(scope.StackData()))
-	copy(stackTmp, scope.StackData())
-	// extracting element in position len(stackTmp) - 2, which is the address to which our contract
-	// will interact, the element 0 is not needed
-	addr := common.Address(stackTmp[len(stackTmp)-2].Bytes20())
-
-	// if the address code was set once, there's no need to refetch it
-	if _, ok := in.addressCodeSet[addr]; ok {
-		return nil
-	}
-
-	// fetch code and storage of address, and register in evm state
-	// retrieving the latest
-	code, err := in.rpcClt.GetCode(addr.Hex(), blk)
-	if err != nil {
-		return err
-	}
-
-	// check if address exists in state
-	if !in.evm.StateDB.Exist(addr) {
-		// create address
-		in.evm.StateDB.CreateAccount(addr)
-	}
-
-	in.evm.StateDB.SetCode(addr, code)
-	in.addressCodeSet[addr] = struct{}{}
-
-	// set balance in case we will need it
-	if op == CALL || op == CALLCODE {
-		value := stackTmp[len(stackTmp)-3]
-		// currentBalance of account
-		currrentStateBalance := in.evm.StateDB.GetBalance(addr)
-		_, balanceSetOnce := in.addressBalanceSet[addr]
-		if value.Cmp(currrentStateBalance) > 0 && !balanceSetOnce {
-			// current balance in account
-			balanceBig, err := in.rpcClt.GetBalance(addr.Hex(), blk)
-			if err != nil {
-				return err
-			}
-			// wanted balance fetched from rpc
-			balance := uint256.MustFromBig(balanceBig)
-
-			if balance.Cmp(&value) >= 0 {
-				diff := new(uint256.Int).Sub(balance, currrentStateBalance)
-				// add the remaining balance, between wanted and current
-				in.evm.StateDB.AddBalance(addr, diff, tracing.BalanceChangeUnspecified)
-				in.addressBalanceSet[addr] = struct{}{}
-			}
-		}
-	}
-
-	return nil
-}
-
-// registerAddressStorage in case the opcode will be
-//
-// we will try to fetch the address storage
-// that will be requested this opcodes on the current blocknumber
-// and register that storage in the evm state.
-// TODO: use cache to avoid double requesting Http
-func (in *EVMInterpreter) registerAddressStorage(op OpCode, scope *ScopeContext, blk string) error {
-	if len(scope.StackData()) < 1 {
-		return errors.New("insufficient elements in stack")
-	}
-
-	// copy data in stack
-	loc := scope.Stack.peek()
-	hash := common.Hash(loc.Bytes32())
-
-	// if the address storage was set once, there's no need to refetch it
-	key := scope.Address().Hex() + ":" + hash.Hex()
-	if _, ok := in.addressStorageSet[key]; ok {
-		return nil
-	}
-
-	// retrieve storage of value in contract in position hash
-	storage, err := in.rpcClt.GetStorageAt(scope.Address().Hex(), hash.Hex(), blk)
-	if err != nil {
-		return err
-	}
-
-	in.evm.StateDB.SetState(scope.Address(), hash, storage)
-	in.addressStorageSet[key] = storage
-
-	return nil
-}
-
-// registerAddressCodeForExt in case the opcode will be
-//
-//	op == EXTCODECOPY || op == EXTCODEHASH || op == EXTCODESIZE
-//
-// we will try to fetch the address code
-// that will be requested this opcodes on the current blocknumber
-// and register that code in the evm state.
-// TODO: use cache to avoid double requesting Http
-func (in *EVMInterpreter) registerAddressCodeForExt(op OpCode, scope *ScopeContext, blk string) error {
-	if len(scope.StackData()) < 1 {
-		return errors.New("insufficient elements in stack")
-	}
-
-	// copy data in stack
-	stackTmp := make([]uint256.Int, len(scope.StackData()))
-	copy(stackTmp, scope.StackData())
-	// extracting element in position len(stackTmp) - 1, which is the address to which our contract
-	// will interact, the element 0 is not needed
-	addr := common.Address(stackTmp[len(stackTmp)-1].Bytes20())
-
-	// if the address code was set once, there's no need to refetch it
-	if _, ok := in.addressCodeSet[addr]; ok {
-		return nil
-	}
-
-	// fetch code and storage of address, and register in evm state
-	// retrieving the latest
-	code, err := in.rpcClt.GetCode(addr.Hex(), blk)
-	if err != nil {
-		return err
-	}
-
-	// check if address exists in state
-	if !in.evm.StateDB.Exist(addr) {
-		// create address
-		in.evm.StateDB.CreateAccount(addr)
-	}
-
-	in.evm.StateDB.SetCode(addr, code)
-	in.addressCodeSet[addr] = struct{}{}
-
-	return nil
-}
-
 // appendToAccessList will fetch the slots in storage involved in SLOAD or SSTORE op
 // and append it to the access list without duplicating addresses
 func (in *EVMInterpreter) appendToAccessList(op OpCode, scope *ScopeContext) {
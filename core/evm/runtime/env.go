@@ -19,12 +19,11 @@ package runtime
 import (
 	vm "github.com/Arjxm/tracer/core/evm"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/holiman/uint256"
 )
 
-func NewEnv(cfg *Config, stateDB *state.StateDB, record *vm.RecordToInitiateState) *vm.EVM {
+func NewEnv(cfg *Config, stateDB vm.StateDB) *vm.EVM {
 	txContext := vm.TxContext{
 		Origin:     cfg.Origin,
 		GasPrice:   cfg.GasPrice,
@@ -39,13 +38,13 @@ func NewEnv(cfg *Config, stateDB *state.StateDB, record *vm.RecordToInitiateStat
 		BlockNumber: cfg.BlockNumber,
 		Time:        cfg.Time,
 		Difficulty:  cfg.Difficulty,
-		GasLimit:    cfg.GasLimit,
+		GasLimit:    cfg.BlockGasLimit,
 		BaseFee:     cfg.BaseFee,
 		BlobBaseFee: cfg.BlobBaseFee,
 		Random:      cfg.Random,
 	}
 
-	return vm.NewEVM(blockContext, txContext, record, stateDB, cfg.ChainConfig, cfg.EVMConfig, cfg.ChainId)
+	return vm.NewEVM(blockContext, txContext, stateDB, cfg.ChainConfig, cfg.EVMConfig)
 }
 
 // CanTransfer checks whether there are enough funds in the address' account to make a transfer.
@@ -18,6 +18,7 @@ package runtime
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
 
@@ -56,14 +57,54 @@ type Config struct {
 	ChainId     uint64
 	ErrorRatio  float64
 
+	// BlockGasLimit is the GASLIMIT of the block, GasLimit is used when unset
+	BlockGasLimit uint64
+	// AccessList is the access list declared by the transaction
+	AccessList types.AccessList
+	// IncrementNonce bumps the origin nonce before a call like a transaction
+	// does, a contract creation always bumps it
+	IncrementNonce bool
+	// TxType is the EIP-2718 type of the transaction reported to the tracer,
+	// GasTipCap and GasFeeCap are its fee caps from EIP-1559 on
+	TxType    uint8
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+
+	// Strict executes like a block transaction does: the nonce is checked
+	// against Nonce when set and bumped, the gas is bought upfront from the
+	// origin, the refund is capped and the coinbase gets the tip
+	Strict bool
+	Nonce  *uint64
+
+	// TxHash and TxIndex identify the transaction in its block, they are set
+	// on the emitted logs
+	TxHash  common.Hash
+	TxIndex int
+
+	// ForkSource is consulted for any account or slot missing in the state,
+	// leave it nil to run only against the given state
+	ForkSource ourVm.ForkStateSource
+	// ForkBlock is the block ForkSource reads the state of, nil for an unknown
+	// one. The later blocks, simulated with an overridden BlockNumber, aren't
+	// on chain so their hashes are made up rather than read from ForkSource
+	ForkBlock *big.Int
+	// BlockHashes are returned by BLOCKHASH for their numbers, the others are
+	// read from ForkSource
+	BlockHashes map[uint64]common.Hash
+
 	GetHashFn func(n uint64) common.Hash
+	// hashes backs the default GetHashFn
+	hashes *blockHashes
 }
 
 type RecordToInitiateState struct {
 	AddressCodeSet    map[common.Address]struct{}
 	AddressBalanceSet map[common.Address]struct{}
+	AddressNonceSet   map[common.Address]struct{}
 	AddressStorageSet map[string]common.Hash
 	AccessList        types.AccessList
+
+	AddressLocalStorageSet map[common.Address]struct{}
 }
 
 // sets defaults on the config
@@ -72,9 +113,14 @@ func SetDefaults(cfg *Config) {
 		var (
 			shanghaiTime = uint64(0)
 			cancunTime   = uint64(0)
+			// every fork is active, on the chain of ChainId or mainnet
+			chainID = big.NewInt(1)
 		)
+		if cfg.ChainId != 0 {
+			chainID = new(big.Int).SetUint64(cfg.ChainId)
+		}
 		cfg.ChainConfig = &params.ChainConfig{
-			ChainID:                       big.NewInt(1),
+			ChainID:                       chainID,
 			HomesteadBlock:                new(big.Int),
 			DAOForkBlock:                  new(big.Int),
 			DAOForkSupport:                false,
@@ -102,6 +148,9 @@ func SetDefaults(cfg *Config) {
 	if cfg.GasLimit == 0 {
 		cfg.GasLimit = math.MaxUint64
 	}
+	if cfg.BlockGasLimit == 0 {
+		cfg.BlockGasLimit = cfg.GasLimit
+	}
 	if cfg.GasPrice == nil {
 		cfg.GasPrice = new(big.Int)
 	}
@@ -112,9 +161,13 @@ func SetDefaults(cfg *Config) {
 		cfg.BlockNumber = new(big.Int)
 	}
 	if cfg.GetHashFn == nil {
-		cfg.GetHashFn = func(n uint64) common.Hash {
-			return common.BytesToHash(crypto.Keccak256([]byte(new(big.Int).SetUint64(n).String())))
+		cfg.hashes = &blockHashes{
+			overrides: cfg.BlockHashes,
+			source:    cfg.ForkSource,
+			forkBlock: cfg.ForkBlock,
+			fetched:   make(map[uint64]common.Hash),
 		}
+		cfg.GetHashFn = cfg.hashes.get
 	}
 	if cfg.BaseFee == nil {
 		cfg.BaseFee = big.NewInt(params.InitialBaseFee)
@@ -123,7 +176,7 @@ func SetDefaults(cfg *Config) {
 		cfg.BlobBaseFee = big.NewInt(params.BlobTxMinBlobGasprice)
 	}
 	// Merge indicators
-	if t := cfg.ChainConfig.ShanghaiTime; cfg.ChainConfig.TerminalTotalDifficultyPassed || (t != nil && *t == 0) {
+	if t := cfg.ChainConfig.ShanghaiTime; cfg.Random == nil && (cfg.ChainConfig.TerminalTotalDifficultyPassed || (t != nil && *t == 0)) {
 		cfg.Random = &(common.Hash{})
 	}
 
@@ -140,12 +193,71 @@ func SetDefaults(cfg *Config) {
 	// }
 }
 
+// blockHashes serves the overridden block hashes, then the ones of the chain
+// the state is forked from, which are cached. Without a fork source, or past
+// the block forked from, the hashes are made up from the numbers.
+type blockHashes struct {
+	overrides map[uint64]common.Hash
+	source    ourVm.ForkStateSource
+	forkBlock *big.Int
+	fetched   map[uint64]common.Hash
+	// err is the first failure to fetch a hash, which is then empty
+	err error
+}
+
+func (h *blockHashes) get(n uint64) common.Hash {
+	if hash, ok := h.overrides[n]; ok {
+		return hash
+	}
+	if h.source == nil || h.forkBlock != nil && h.forkBlock.Cmp(new(big.Int).SetUint64(n)) < 0 {
+		return common.BytesToHash(crypto.Keccak256([]byte(new(big.Int).SetUint64(n).String())))
+	}
+	if hash, ok := h.fetched[n]; ok {
+		return hash
+	}
+	hash, err := h.source.GetBlockHash(n)
+	if err != nil {
+		if h.err == nil {
+			h.err = fmt.Errorf("hash of block %d: %w", n, err)
+		}
+		return common.Hash{}
+	}
+	h.fetched[n] = hash
+	return hash
+}
+
+// forkError returns the failure to fetch the state, or a block hash, during an
+// execution with cfg.
+func forkError(cfg *Config, statedb *ourVm.ForkedStateDB) error {
+	if err := statedb.Error(); err != nil {
+		return fmt.Errorf("%w: %v", ErrForkState, err)
+	}
+	if cfg.hashes != nil && cfg.hashes.err != nil {
+		return fmt.Errorf("%w: %v", ErrForkState, cfg.hashes.err)
+	}
+	return nil
+}
+
+// ErrForkState is returned when the state couldn't be fetched from the fork
+// source, the execution result is meaningless in that case.
+var ErrForkState = errors.New("failed to fetch forked state")
+
 type ExecutionResult struct {
 	Ret          []byte
 	GasUsed      uint64
 	Refund       uint64
 	IntrinsicGas uint64
 	Record       *RecordToInitiateState
+	// Err is the execution error, e.g. a revert, in strict mode the
+	// transaction still pays for its gas. The error returned along the result
+	// is reserved to a transaction that can't run or a broken fork state.
+	Err error
+	// Logs emitted by the execution, none when it failed
+	Logs []*types.Log
+	// ContractAddress and CodeSize describe the deployed contract, they are
+	// only set by Create
+	ContractAddress common.Address
+	CodeSize        int
 }
 
 // Execute executes the code using the input as call data during the execution.
@@ -162,6 +274,129 @@ func Execute(
 	cfg *Config,
 	state *state.StateDB,
 	recordToInit *ourVm.RecordToInitiateState,
+) (*ExecutionResult, error) {
+	return execute(&address, originBalance, code, input, cfg, state, recordToInit)
+}
+
+// Create executes the input as initcode, deploying a new contract from the
+// origin of the config. The result holds the address of the contract and the
+// size of its runtime code.
+func Create(
+	originBalance *big.Int,
+	input []byte,
+	cfg *Config,
+	state *state.StateDB,
+	recordToInit *ourVm.RecordToInitiateState,
+) (*ExecutionResult, error) {
+	return execute(nil, originBalance, nil, input, cfg, state, recordToInit)
+}
+
+// StaticCall calls address with input from the origin of the config without
+// changing the state, as eth_call does for a view function. The tracer of the
+// config isn't told about it.
+func StaticCall(
+	address common.Address,
+	input []byte,
+	cfg *Config,
+	state *state.StateDB,
+	recordToInit *ourVm.RecordToInitiateState,
+) ([]byte, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	SetDefaults(cfg)
+	if state == nil {
+		return nil, errors.New("state db missing please provide one in the config file")
+	}
+	untraced := *cfg
+	untraced.EVMConfig.Tracer = nil
+	var (
+		statedb = ourVm.NewForkedStateDB(state, cfg.ForkSource, recordToInit)
+		vmenv   = NewEnv(&untraced, statedb)
+	)
+	ret, _, err := vmenv.StaticCall(vm.AccountRef(cfg.Origin), address, input, cfg.GasLimit)
+	if ferr := forkError(cfg, statedb); ferr != nil {
+		return nil, ferr
+	}
+	return ret, err
+}
+
+// newTx returns the transaction of the given config, as reported to the tracer.
+func newTx(cfg *Config, nonce uint64, dest *common.Address, input []byte) *types.Transaction {
+	gasTipCap, gasFeeCap := cfg.GasTipCap, cfg.GasFeeCap
+	if gasFeeCap == nil {
+		gasTipCap, gasFeeCap = cfg.GasPrice, cfg.GasPrice
+	}
+	if gasTipCap == nil {
+		gasTipCap = new(big.Int)
+	}
+
+	switch cfg.TxType {
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    cfg.ChainConfig.ChainID,
+			Nonce:      nonce,
+			GasPrice:   cfg.GasPrice,
+			Gas:        cfg.GasLimit,
+			To:         dest,
+			Value:      cfg.Value,
+			Data:       input,
+			AccessList: cfg.AccessList,
+		})
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    cfg.ChainConfig.ChainID,
+			Nonce:      nonce,
+			GasTipCap:  gasTipCap,
+			GasFeeCap:  gasFeeCap,
+			Gas:        cfg.GasLimit,
+			To:         dest,
+			Value:      cfg.Value,
+			Data:       input,
+			AccessList: cfg.AccessList,
+		})
+	case types.BlobTxType:
+		// a blob transaction can't create a contract
+		var to common.Address
+		if dest != nil {
+			to = *dest
+		}
+		blobFeeCap := cfg.BlobFeeCap
+		if blobFeeCap == nil {
+			blobFeeCap = new(big.Int)
+		}
+		return types.NewTx(&types.BlobTx{
+			ChainID:    uint256.MustFromBig(cfg.ChainConfig.ChainID),
+			Nonce:      nonce,
+			GasTipCap:  uint256.MustFromBig(gasTipCap),
+			GasFeeCap:  uint256.MustFromBig(gasFeeCap),
+			Gas:        cfg.GasLimit,
+			To:         to,
+			Value:      uint256.MustFromBig(cfg.Value),
+			Data:       input,
+			AccessList: cfg.AccessList,
+			BlobFeeCap: uint256.MustFromBig(blobFeeCap),
+			BlobHashes: cfg.BlobHashes,
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: cfg.GasPrice,
+		Gas:      cfg.GasLimit,
+		To:       dest,
+		Value:    cfg.Value,
+		Data:     input,
+	})
+}
+
+// execute runs a call to dest, or a contract creation when dest is nil.
+func execute(
+	dest *common.Address,
+	originBalance *big.Int,
+	code, input []byte,
+	cfg *Config,
+	state *state.StateDB,
+	recordToInit *ourVm.RecordToInitiateState,
 ) (*ExecutionResult, error) {
 	if cfg == nil {
 		cfg = new(Config)
@@ -171,83 +406,254 @@ func Execute(
 	if state == nil {
 		return nil, errors.New("state db missing please provide one in the config file")
 	}
+	// a hash that failed to be fetched by a previous execution is fetched again
+	if cfg.hashes != nil {
+		cfg.hashes.err = nil
+	}
 	var (
-		vmenv  = NewEnv(cfg, state, recordToInit)
-		sender = vm.AccountRef(cfg.Origin)
-		rules  = cfg.ChainConfig.Rules(vmenv.Context.BlockNumber, vmenv.Context.Random != nil, vmenv.Context.Time)
+		statedb = ourVm.NewForkedStateDB(state, cfg.ForkSource, recordToInit)
+		vmenv   = NewEnv(cfg, statedb)
+		sender  = vm.AccountRef(cfg.Origin)
+		rules   = cfg.ChainConfig.Rules(vmenv.Context.BlockNumber, vmenv.Context.Random != nil, vmenv.Context.Time)
 	)
+	// finalise as it's done between the transactions of a block, so the next
+	// execution on this state sees the changes as committed
+	defer statedb.Finalise(true)
 
-	if cfg.EVMConfig.Tracer != nil && cfg.EVMConfig.Tracer.OnTxStart != nil {
-		cfg.EVMConfig.Tracer.OnTxStart(vmenv.GetVMContext(), types.NewTx(&types.LegacyTx{To: &address, Data: input, Value: cfg.Value, Gas: cfg.GasLimit}), cfg.Origin)
+	// logs are kept by transaction hash in the state, only the ones added by
+	// this execution are returned
+	statedb.SetTxContext(cfg.TxHash, cfg.TxIndex)
+	logsBefore := len(statedb.GetLogs(cfg.TxHash, cfg.BlockNumber.Uint64(), common.Hash{}))
+
+	// state changes are reported to the tracer through the state hooks
+	if cfg.EVMConfig.Tracer != nil {
+		statedb.SetLogger(cfg.EVMConfig.Tracer)
+		defer statedb.SetLogger(nil)
 	}
-	// fetch origin account
-	originAcc, err := state.GetTrie().GetAccount(cfg.Origin)
-	if err != nil {
-		return nil, err
+
+	if cfg.EVMConfig.Tracer != nil && cfg.EVMConfig.Tracer.OnTxStart != nil {
+		cfg.EVMConfig.Tracer.OnTxStart(vmenv.GetVMContext(), newTx(cfg, statedb.GetNonce(cfg.Origin), dest, input), cfg.Origin)
 	}
 
-	if originAcc == nil {
+	if !statedb.Exist(cfg.Origin) {
 		// register origin account in case is not
-		state.CreateAccount(cfg.Origin)
+		statedb.CreateAccount(cfg.Origin)
 	}
 
 	if originBalance.Cmp(big.NewInt(0)) > 0 {
 		// get balance of origin
 		balance := uint256.MustFromBig(originBalance)
-		state.SetBalance(cfg.Origin, balance, tracing.BalanceChangeUnspecified)
-		state.SetBalance(sender.Address(), balance, tracing.BalanceChangeUnspecified)
-		vmenv.Interpreter().MarkAddressBalance(cfg.Origin)
+		statedb.SetBalance(cfg.Origin, balance, tracing.BalanceChangeUnspecified)
+		statedb.MarkAddressBalance(cfg.Origin)
+	}
+
+	var (
+		intrinsicGas uint64
+		gas          = cfg.GasLimit
+	)
+	if cfg.Strict {
+		snapshot := statedb.Snapshot()
+		var err error
+		if intrinsicGas, err = preCheck(cfg, statedb, rules, dest, input); err != nil {
+			statedb.RevertToSnapshot(snapshot)
+			return nil, err
+		}
+		gas -= intrinsicGas
 	}
 
 	// Execute the preparatory steps for state transition which includes:
 	// - prepare accessList(post-berlin)
 	// - reset transient storage(eip 1153)
-	var accessList types.AccessList
+	accessList := cfg.AccessList
 	if recordToInit != nil {
-		accessList = recordToInit.AccessList
+		accessList = append(append(types.AccessList{}, accessList...), recordToInit.AccessList...)
 	}
 
-	state.Prepare(rules, cfg.Origin, cfg.Coinbase, &address, vm.ActivePrecompiles(rules), accessList)
-	if !state.Exist(address) {
-		state.CreateAccount(address)
+	statedb.Prepare(rules, cfg.Origin, cfg.Coinbase, dest, vm.ActivePrecompiles(rules), accessList)
+	if dest != nil && len(code) > 0 {
 		// set the receiver's (the executing contract) code for execution.
-		state.SetCode(address, code)
-		vmenv.Interpreter().MarkAddressCode(address)
+		if !statedb.Exist(*dest) {
+			statedb.CreateAccount(*dest)
+		}
+		statedb.SetCode(*dest, code)
+		statedb.MarkAddressCode(*dest)
 	}
 
-	// Call the code with the given configuration.
-	ret, leftOverGas, err := vmenv.Call(
-		sender,
-		address,
-		input,
-		cfg.GasLimit,
-		uint256.MustFromBig(cfg.Value),
+	var (
+		ret          []byte
+		leftOverGas  uint64
+		contractAddr common.Address
+		err          error
 	)
-	if err != nil {
-		return nil, err
+	if dest == nil {
+		// Deploy the initcode with the given configuration.
+		ret, contractAddr, leftOverGas, err = vmenv.Create(
+			sender,
+			input,
+			gas,
+			uint256.MustFromBig(cfg.Value),
+		)
+	} else {
+		if cfg.IncrementNonce || cfg.Strict {
+			statedb.SetNonce(cfg.Origin, statedb.GetNonce(cfg.Origin)+1)
+		}
+		// Call the code with the given configuration.
+		ret, leftOverGas, err = vmenv.Call(
+			sender,
+			*dest,
+			input,
+			gas,
+			uint256.MustFromBig(cfg.Value),
+		)
 	}
-
-	inRecord := vmenv.Interpreter().GetRecordToInitState()
-	intrinsicGas, err := core.IntrinsicGas(input, inRecord.AccessList, false, cfg.ChainConfig.IsHomestead(new(big.Int)), cfg.ChainConfig.IsIstanbul(new(big.Int)), cfg.ChainConfig.IsShanghai(new(big.Int), 0))
-	if err != nil {
-		return nil, err
+	if ferr := forkError(cfg, statedb); ferr != nil {
+		return nil, ferr
 	}
+	// a failed execution, e.g. a revert, still has a result
+	vmErr := err
 
-	refund := vmenv.StateDB.GetRefund()
-	gasUsed := cfg.GasLimit - leftOverGas + intrinsicGas - refund
+	inRecord := statedb.GetRecordToInitState()
+	inRecord.AccessList = vmenv.Interpreter().AccessList()
+
+	var gasUsed, refund uint64
+	if cfg.Strict {
+		gasUsed, refund = settleGas(cfg, statedb, rules, leftOverGas)
+	} else {
+		intrinsicGas, err = core.IntrinsicGas(input, inRecord.AccessList, dest == nil, cfg.ChainConfig.IsHomestead(new(big.Int)), cfg.ChainConfig.IsIstanbul(new(big.Int)), cfg.ChainConfig.IsShanghai(new(big.Int), 0))
+		if err != nil {
+			return nil, err
+		}
+		refund = vmenv.StateDB.GetRefund()
+		gasUsed = cfg.GasLimit - leftOverGas + intrinsicGas - refund
+	}
 
 	record := &RecordToInitiateState{
 		AddressCodeSet:    inRecord.AddressCodeSet,
 		AddressBalanceSet: inRecord.AddressBalanceSet,
+		AddressNonceSet:   inRecord.AddressNonceSet,
 		AddressStorageSet: inRecord.AddressStorageSet,
 		AccessList:        inRecord.AccessList,
+
+		AddressLocalStorageSet: inRecord.AddressLocalStorageSet,
 	}
 
-	return &ExecutionResult{
+	result := &ExecutionResult{
 		Ret:          ret,
 		GasUsed:      gasUsed,
 		Refund:       refund,
 		IntrinsicGas: intrinsicGas,
 		Record:       record,
-	}, nil
+		Err:          vmErr,
+		Logs:         statedb.GetLogs(cfg.TxHash, cfg.BlockNumber.Uint64(), common.Hash{})[logsBefore:],
+	}
+	if dest == nil && vmErr == nil {
+		result.ContractAddress = contractAddr
+		result.CodeSize = statedb.GetCodeSize(contractAddr)
+	}
+	return result, nil
+}
+
+// preCheck validates the transaction of a strict execution and buys its gas
+// from the origin, as geth's state transition does before running it. It
+// returns the intrinsic gas of the transaction.
+func preCheck(cfg *Config, statedb *ourVm.ForkedStateDB, rules params.Rules, dest *common.Address, input []byte) (uint64, error) {
+	nonce := statedb.GetNonce(cfg.Origin)
+	if cfg.Nonce != nil {
+		switch {
+		case nonce < *cfg.Nonce:
+			return 0, fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooHigh, cfg.Origin.Hex(), *cfg.Nonce, nonce)
+		case nonce > *cfg.Nonce:
+			return 0, fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooLow, cfg.Origin.Hex(), *cfg.Nonce, nonce)
+		}
+	}
+	// EIP-3607, only accounts without code can send transactions
+	if codeHash := statedb.GetCodeHash(cfg.Origin); codeHash != (common.Hash{}) && codeHash != types.EmptyCodeHash {
+		return 0, fmt.Errorf("%w: address %v, codehash: %s", core.ErrSenderNoEOA, cfg.Origin.Hex(), codeHash)
+	}
+	// a legacy or access list transaction bids its gas price as both caps
+	feeCap, tipCap := cfg.GasFeeCap, cfg.GasTipCap
+	if feeCap == nil {
+		feeCap, tipCap = cfg.GasPrice, cfg.GasPrice
+	}
+	if tipCap == nil {
+		tipCap = new(big.Int)
+	}
+	if rules.IsLondon {
+		if feeCap.Cmp(tipCap) < 0 {
+			return 0, fmt.Errorf("%w: address %v, maxPriorityFeePerGas: %s, maxFeePerGas: %s", core.ErrTipAboveFeeCap, cfg.Origin.Hex(), tipCap, feeCap)
+		}
+		if feeCap.Cmp(cfg.BaseFee) < 0 {
+			return 0, fmt.Errorf("%w: address %v, maxFeePerGas: %s, baseFee: %s", core.ErrFeeCapTooLow, cfg.Origin.Hex(), feeCap, cfg.BaseFee)
+		}
+	}
+	blobGas, blobFeeCap := uint64(len(cfg.BlobHashes))*params.BlobTxBlobGasPerBlob, cfg.BlobFeeCap
+	if blobFeeCap == nil {
+		blobFeeCap = new(big.Int)
+	}
+	if blobGas > 0 && rules.IsCancun && blobFeeCap.Cmp(cfg.BlobBaseFee) < 0 {
+		return 0, fmt.Errorf("%w: address %v blobGasFeeCap: %v, blobBaseFee: %v", core.ErrBlobFeeCapTooLow, cfg.Origin.Hex(), blobFeeCap, cfg.BlobBaseFee)
+	}
+
+	// the balance must cover the caps, but only the actual price is paid
+	gasLimit := new(big.Int).SetUint64(cfg.GasLimit)
+	cost := new(big.Int).Mul(gasLimit, cfg.GasPrice)
+	balanceCheck := new(big.Int).Set(cost)
+	if cfg.GasFeeCap != nil {
+		balanceCheck.Mul(gasLimit, cfg.GasFeeCap)
+	}
+	balanceCheck.Add(balanceCheck, cfg.Value)
+	if blobGas > 0 && rules.IsCancun {
+		blobGasBig := new(big.Int).SetUint64(blobGas)
+		balanceCheck.Add(balanceCheck, new(big.Int).Mul(blobGasBig, blobFeeCap))
+		cost.Add(cost, new(big.Int).Mul(blobGasBig, cfg.BlobBaseFee))
+	}
+	if have := statedb.GetBalance(cfg.Origin).ToBig(); have.Cmp(balanceCheck) < 0 {
+		return 0, fmt.Errorf("%w: address %v have %v want %v", core.ErrInsufficientFunds, cfg.Origin.Hex(), have, balanceCheck)
+	}
+	statedb.SubBalance(cfg.Origin, uint256.MustFromBig(cost), tracing.BalanceDecreaseGasBuy)
+
+	contractCreation := dest == nil
+	intrinsicGas, err := core.IntrinsicGas(input, cfg.AccessList, contractCreation, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		return 0, err
+	}
+	if cfg.GasLimit < intrinsicGas {
+		return 0, fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, cfg.GasLimit, intrinsicGas)
+	}
+	if !CanTransfer(statedb, cfg.Origin, uint256.MustFromBig(cfg.Value)) {
+		return 0, fmt.Errorf("%w: address %v", core.ErrInsufficientFundsForTransfer, cfg.Origin.Hex())
+	}
+	if rules.IsShanghai && contractCreation && len(input) > params.MaxInitCodeSize {
+		return 0, fmt.Errorf("%w: code size %v limit %v", core.ErrMaxInitCodeSizeExceeded, len(input), params.MaxInitCodeSize)
+	}
+	return intrinsicGas, nil
+}
+
+// settleGas ends a strict execution: the refund is applied with its cap, the
+// gas left is returned to the origin and the coinbase gets the tip. It returns
+// the gas used by the transaction and the refund applied.
+func settleGas(cfg *Config, statedb *ourVm.ForkedStateDB, rules params.Rules, leftOverGas uint64) (uint64, uint64) {
+	gasUsed := cfg.GasLimit - leftOverGas
+
+	// EIP-3529 lowered the refund cap from a half to a fifth of the gas used
+	refundQuotient := params.RefundQuotient
+	if rules.IsLondon {
+		refundQuotient = params.RefundQuotientEIP3529
+	}
+	refund := min(gasUsed/refundQuotient, statedb.GetRefund())
+	gasUsed -= refund
+	leftOverGas += refund
+
+	remaining := new(big.Int).Mul(new(big.Int).SetUint64(leftOverGas), cfg.GasPrice)
+	statedb.AddBalance(cfg.Origin, uint256.MustFromBig(remaining), tracing.BalanceIncreaseGasReturn)
+
+	tip := new(big.Int).Set(cfg.GasPrice)
+	if rules.IsLondon {
+		tip.Sub(tip, cfg.BaseFee)
+	}
+	if tip.Sign() > 0 {
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), tip)
+		statedb.AddBalance(cfg.Coinbase, uint256.MustFromBig(fee), tracing.BalanceIncreaseRewardTransactionFee)
+	}
+	return gasUsed, refund
 }
@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestStrictExecute(t *testing.T) {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		origin   = common.HexToAddress("0xa1")
+		coinbase = common.HexToAddress("0xc0")
+		contract = common.HexToAddress("0xb2")
+		balance  = big.NewInt(1e18)
+		// SSTORE(0, 1) then SSTORE(0, 0), which earns a refund
+		code = []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x60, 0x00, 0x60, 0x00, 0x55, 0x00}
+	)
+	cfg := &Config{
+		Origin:   origin,
+		Coinbase: coinbase,
+		GasLimit: 100000,
+		GasPrice: big.NewInt(3e9),
+		BaseFee:  big.NewInt(1e9),
+		Strict:   true,
+	}
+	result, err := Execute(contract, balance, code, nil, cfg, statedb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err != nil {
+		t.Fatalf("execution failed: %v", result.Err)
+	}
+	if result.Refund == 0 || result.Refund > (result.GasUsed+result.Refund)/params.RefundQuotientEIP3529 {
+		t.Errorf("refund %d not capped to a fifth of %d", result.Refund, result.GasUsed+result.Refund)
+	}
+
+	paid := new(big.Int).Sub(balance, statedb.GetBalance(origin).ToBig())
+	if want := new(big.Int).Mul(new(big.Int).SetUint64(result.GasUsed), cfg.GasPrice); paid.Cmp(want) != 0 {
+		t.Errorf("origin paid %v, want %v", paid, want)
+	}
+	tip := statedb.GetBalance(coinbase).ToBig()
+	if want := new(big.Int).Mul(new(big.Int).SetUint64(result.GasUsed), big.NewInt(2e9)); tip.Cmp(want) != 0 {
+		t.Errorf("coinbase got %v, want %v", tip, want)
+	}
+	if nonce := statedb.GetNonce(origin); nonce != 1 {
+		t.Errorf("nonce: have %d, want 1", nonce)
+	}
+
+	nonce := uint64(0)
+	cfg.Nonce = &nonce
+	if _, err := Execute(contract, new(big.Int), nil, nil, cfg, statedb, nil); !errors.Is(err, core.ErrNonceTooLow) {
+		t.Errorf("stale nonce: have %v, want %v", err, core.ErrNonceTooLow)
+	}
+	cfg.Nonce, cfg.GasLimit = nil, 20000
+	if _, err := Execute(contract, new(big.Int), nil, make([]byte, 1000), cfg, statedb, nil); !errors.Is(err, core.ErrIntrinsicGas) {
+		t.Errorf("intrinsic gas: have %v, want %v", err, core.ErrIntrinsicGas)
+	}
+}
+
+func TestStrictPreCheckFees(t *testing.T) {
+	gwei := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.GWei)) }
+	tests := []struct {
+		name string
+		cfg  Config
+		want error
+	}{
+		{
+			name: "legacy",
+			cfg:  Config{GasPrice: gwei(2)},
+		},
+		{
+			name: "legacy below base fee",
+			cfg:  Config{GasPrice: gwei(1)},
+			want: core.ErrFeeCapTooLow,
+		},
+		{
+			name: "access list below base fee",
+			cfg:  Config{TxType: types.AccessListTxType, GasPrice: big.NewInt(1)},
+			want: core.ErrFeeCapTooLow,
+		},
+		{
+			name: "fee cap below base fee",
+			cfg:  Config{TxType: types.DynamicFeeTxType, GasPrice: gwei(1), GasFeeCap: gwei(1), GasTipCap: gwei(1)},
+			want: core.ErrFeeCapTooLow,
+		},
+		{
+			name: "tip above fee cap",
+			cfg:  Config{TxType: types.DynamicFeeTxType, GasPrice: gwei(3), GasFeeCap: gwei(3), GasTipCap: gwei(4)},
+			want: core.ErrTipAboveFeeCap,
+		},
+		{
+			name: "blob fee cap below blob base fee",
+			cfg: Config{TxType: types.BlobTxType, GasPrice: gwei(3), GasFeeCap: gwei(3), GasTipCap: gwei(1),
+				BlobHashes: []common.Hash{{0x01}}, BlobFeeCap: big.NewInt(1), BlobBaseFee: big.NewInt(2)},
+			want: core.ErrBlobFeeCapTooLow,
+		},
+		{
+			name: "blob",
+			cfg: Config{TxType: types.BlobTxType, GasPrice: gwei(3), GasFeeCap: gwei(3), GasTipCap: gwei(1),
+				BlobHashes: []common.Hash{{0x01}}, BlobFeeCap: big.NewInt(2), BlobBaseFee: big.NewInt(2)},
+		},
+	}
+	for _, test := range tests {
+		statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := test.cfg
+		cfg.Origin = common.HexToAddress("0xa1")
+		cfg.GasLimit = 100000
+		cfg.BaseFee = gwei(2)
+		cfg.Strict = true
+		_, err = Execute(common.HexToAddress("0xb2"), big.NewInt(1e18), nil, nil, &cfg, statedb, nil)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: have %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDefaultChainID(t *testing.T) {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// returns CHAINID
+	code := []byte{0x46, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3}
+	cfg := &Config{Origin: common.HexToAddress("0xa1"), GasLimit: 100000, ChainId: 1337}
+	result, err := Execute(common.HexToAddress("0xb2"), new(big.Int), code, nil, cfg, statedb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := new(big.Int).SetBytes(result.Ret); id.Uint64() != 1337 {
+		t.Errorf("CHAINID: have %v, want 1337", id)
+	}
+	if cfg.ChainConfig.ChainID.Uint64() != 1337 {
+		t.Errorf("chain config id: have %v, want 1337", cfg.ChainConfig.ChainID)
+	}
+}
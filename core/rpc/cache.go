@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+)
+
+// ErrCacheMiss is returned by an offline client for any request that is not
+// in the cache.
+var ErrCacheMiss = errors.New("not found in cache while offline")
+
+// Cache persists RPC results that can't change, i.e. everything read at a
+// fixed block number, so replaying the same blocks doesn't hit the network.
+type Cache struct {
+	db *leveldb.Database
+}
+
+// DefaultCacheDir returns the cache location, ~/.cache/tracer on linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tracer"), nil
+}
+
+// OpenCache opens or creates the cache stored in dir.
+func OpenCache(dir string) (*Cache, error) {
+	db, err := leveldb.New(dir, 16, 16, "", false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache in %s: %w", dir, err)
+	}
+	return &Cache{db: db}, nil
+}
+
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+func (c *Cache) get(key []byte) (json.RawMessage, bool) {
+	value, err := c.db.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *Cache) put(key []byte, value json.RawMessage) error {
+	return c.db.Put(key, value)
+}
+
+// cacheKey builds the key of a request made at blk, nil is returned when the
+// block isn't a fixed number and the result must not be cached.
+func cacheKey(chainId uint64, method, blk string, args ...string) []byte {
+	if !strings.HasPrefix(blk, "0x") {
+		return nil
+	}
+	return []byte(fmt.Sprintf("%d/%s/%s/%s", chainId, blk, method, strings.Join(args, "/")))
+}
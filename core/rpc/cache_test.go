@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCache(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"id":1,"jsonrpc":"2.0","result":"0x6001"}`))
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	clt := &Client{RpcUrl: srv.URL, ChainId: 1, Cache: cache}
+	addr := "0x00000000000000000000000000000000000000aa"
+
+	for i := 0; i < 2; i++ {
+		if _, err := clt.GetCode(addr, "0x10"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("fixed block not cached: %d requests", requests)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := clt.GetCode(addr, "latest"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 3 {
+		t.Fatalf("latest block must bypass the cache: %d requests", requests)
+	}
+
+	clt.Offline = true
+	if _, err := clt.GetCode(addr, "0x10"); err != nil {
+		t.Fatalf("cached entry not served offline: %v", err)
+	}
+	if _, err := clt.GetCode(addr, "0x11"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("offline miss: have %v, want %v", err, ErrCacheMiss)
+	}
+	if requests != 3 {
+		t.Fatalf("offline client hit the network")
+	}
+}
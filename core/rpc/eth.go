@@ -7,14 +7,21 @@ import (
 	"github.com/Arjxm/tracer/core/config"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"io"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 type Client struct {
-	RpcUrl string
+	RpcUrl  string
+	ChainId uint64
+	// Cache is consulted before the network for requests made at a fixed
+	// block, when Offline is set a cache miss is an error
+	Cache   *Cache
+	Offline bool
 }
 
 type Request struct {
@@ -40,29 +47,50 @@ func (e *ErrResponse) Error() string {
 	return fmt.Sprintf(`{"code": "%d", "message": "%s"}`, e.Code, e.Message)
 }
 
+// blockArg checks blk is a block number in hex or a tag of a block whose state
+// can be read, an empty blk being the latest block. A number is returned in
+// its canonical encoding. The pending block is refused, its state isn't there
+// to fork from.
+func blockArg(blk string) (string, error) {
+	switch blk {
+	case "", "latest":
+		return "latest", nil
+	case "earliest", "safe", "finalized":
+		return blk, nil
+	}
+	if strings.HasPrefix(blk, "0x") {
+		if number, ok := new(big.Int).SetString(blk[2:], 16); ok && number.Sign() >= 0 {
+			return hexutil.EncodeBig(number), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported block %q, want a number in hex, latest, earliest, safe or finalized", blk)
+}
+
 func NewClient(chainId uint64) *Client {
 	rpcUrl, err := config.GetRPCUrl(chainId)
 	if err != nil {
 		panic(err)
 	}
-	return &Client{RpcUrl: rpcUrl}
+	return &Client{RpcUrl: rpcUrl, ChainId: chainId}
 }
 
 func (c *Client) GetCode(address, blk string) ([]byte, error) {
-	// try to convert block into number
-	blkNumber, ok := new(big.Int).SetString(strings.TrimLeft(blk, "0x"), 16)
-	if !ok || blkNumber.Cmp(big.NewInt(0)) <= 0 {
-		blk = "latest"
+	blk, err := blockArg(blk)
+	if err != nil {
+		return nil, err
 	}
 
 	params := []interface{}{
 		address, blk,
 	}
 
-	rpcResp, err := rpcPost(c.RpcUrl, "eth_getCode", params)
+	rpcResp, err := c.post("eth_getCode", params, cacheKey(c.ChainId, "eth_getCode", blk, strings.ToLower(address)))
 	if err != nil {
 		return nil, err
 	}
+	if rpcResp.Err != nil {
+		return nil, rpcResp.Err
+	}
 
 	resultB, _ := rpcResp.Result.MarshalJSON()
 
@@ -72,23 +100,26 @@ func (c *Client) GetCode(address, blk string) ([]byte, error) {
 		return nil, err
 	}
 
-	return hexutil.MustDecode(result), nil
+	return hexutil.Decode(result)
 }
 
 func (c *Client) GetStorageAt(address, position, blk string) (common.Hash, error) {
-	blkNumber, ok := new(big.Int).SetString(strings.TrimLeft(blk, "0x"), 16)
-	if !ok || blkNumber.Cmp(big.NewInt(0)) <= 0 {
-		blk = "latest"
+	blk, err := blockArg(blk)
+	if err != nil {
+		return common.Hash{}, err
 	}
 
 	params := []interface{}{
 		address, position, blk,
 	}
 
-	rpcResp, err := rpcPost(c.RpcUrl, "eth_getStorageAt", params)
+	rpcResp, err := c.post("eth_getStorageAt", params, cacheKey(c.ChainId, "eth_getStorageAt", blk, strings.ToLower(address), strings.ToLower(position)))
 	if err != nil {
 		return common.Hash{}, err
 	}
+	if rpcResp.Err != nil {
+		return common.Hash{}, rpcResp.Err
+	}
 
 	resultB, _ := rpcResp.Result.MarshalJSON()
 
@@ -116,20 +147,53 @@ func (c *Client) GetCodeAndStorageAt(address, position, blk string) ([]byte, com
 	return code, storage, nil
 }
 
+// GetStorageHash returns the storage root of address, read from its
+// eth_getProof without any slot.
+func (c *Client) GetStorageHash(address, blk string) (common.Hash, error) {
+	blk, err := blockArg(blk)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	params := []interface{}{
+		address, []string{}, blk,
+	}
+
+	rpcResp, err := c.post("eth_getProof", params, cacheKey(c.ChainId, "eth_getProof", blk, strings.ToLower(address)))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if rpcResp.Err != nil {
+		return common.Hash{}, rpcResp.Err
+	}
+
+	var proof struct {
+		StorageHash common.Hash `json:"storageHash"`
+	}
+	if err := json.Unmarshal(rpcResp.Result, &proof); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid proof received in response: %w", err)
+	}
+
+	return proof.StorageHash, nil
+}
+
 func (c *Client) GetBalance(address, blk string) (*big.Int, error) {
-	blkNumber, ok := new(big.Int).SetString(strings.TrimLeft(blk, "0x"), 16)
-	if !ok || blkNumber.Cmp(big.NewInt(0)) <= 0 {
-		blk = "latest"
+	blk, err := blockArg(blk)
+	if err != nil {
+		return nil, err
 	}
 
 	params := []interface{}{
 		address, blk,
 	}
 
-	rpcResp, err := rpcPost(c.RpcUrl, "eth_getBalance", params)
+	rpcResp, err := c.post("eth_getBalance", params, cacheKey(c.ChainId, "eth_getBalance", blk, strings.ToLower(address)))
 	if err != nil {
 		return nil, err
 	}
+	if rpcResp.Err != nil {
+		return nil, rpcResp.Err
+	}
 
 	resultB, _ := rpcResp.Result.MarshalJSON()
 
@@ -147,17 +211,113 @@ func (c *Client) GetBalance(address, blk string) (*big.Int, error) {
 	return balance, nil
 }
 
-func (c *Client) EstimateGas(from common.Address, to common.Address, value *big.Int, input []byte) (uint64, error) {
+func (c *Client) GetNonce(address, blk string) (uint64, error) {
+	blk, err := blockArg(blk)
+	if err != nil {
+		return 0, err
+	}
+
+	params := []interface{}{
+		address, blk,
+	}
+
+	rpcResp, err := c.post("eth_getTransactionCount", params, cacheKey(c.ChainId, "eth_getTransactionCount", blk, strings.ToLower(address)))
+	if err != nil {
+		return 0, err
+	}
+	if rpcResp.Err != nil {
+		return 0, rpcResp.Err
+	}
+
+	var nonce hexutil.Uint64
+	err = json.Unmarshal(rpcResp.Result, &nonce)
+	if err != nil {
+		return 0, fmt.Errorf("invalid nonce received in response: %w", err)
+	}
+
+	return uint64(nonce), nil
+}
+
+// GetBlockByNumber returns the block at blk, with its transactions as objects
+// when fullTx is set or as hashes otherwise.
+func (c *Client) GetBlockByNumber(blk string, fullTx bool) (map[string]interface{}, error) {
+	blk, err := blockArg(blk)
+	if err != nil {
+		return nil, err
+	}
+
 	params := []interface{}{
-		map[string]interface{}{
-			"from":  from.Hex(),
-			"to":    to.Hex(),
-			"value": (*hexutil.Big)(value).String(),
-			"data":  hexutil.Bytes(input).String(),
-		},
+		blk, fullTx,
 	}
 
-	rpcResp, err := rpcPost(c.RpcUrl, "eth_estimateGas", params)
+	rpcResp, err := c.post("eth_getBlockByNumber", params, cacheKey(c.ChainId, "eth_getBlockByNumber", blk, strconv.FormatBool(fullTx)))
+	if err != nil {
+		return nil, fmt.Errorf("RPC call failed: %w", err)
+	}
+
+	if rpcResp.Err != nil {
+		return nil, fmt.Errorf("RPC error: %s", rpcResp.Err.Error())
+	}
+
+	var result map[string]interface{}
+	err = json.Unmarshal(rpcResp.Result, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block: %w", err)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("block %s not found", blk)
+	}
+	return result, nil
+}
+
+// CallArgs is a transaction that isn't signed, as passed to eth_estimateGas.
+// The fee fields and the access list are left out when nil.
+type CallArgs struct {
+	From                 common.Address
+	To                   *common.Address
+	Value                *big.Int
+	Data                 []byte
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	AccessList           types.AccessList
+}
+
+// EstimateGas estimates the gas of call on the state at blk, call being a
+// contract creation when its To is nil.
+func (c *Client) EstimateGas(call CallArgs, blk string) (uint64, error) {
+	blk, err := blockArg(blk)
+	if err != nil {
+		return 0, err
+	}
+
+	args := map[string]interface{}{
+		"from": call.From.Hex(),
+		"data": hexutil.Bytes(call.Data).String(),
+	}
+	if call.To != nil {
+		args["to"] = call.To.Hex()
+	}
+	if call.Value != nil {
+		args["value"] = (*hexutil.Big)(call.Value).String()
+	}
+	if call.GasPrice != nil {
+		args["gasPrice"] = (*hexutil.Big)(call.GasPrice).String()
+	}
+	if call.MaxFeePerGas != nil {
+		args["maxFeePerGas"] = (*hexutil.Big)(call.MaxFeePerGas).String()
+	}
+	if call.MaxPriorityFeePerGas != nil {
+		args["maxPriorityFeePerGas"] = (*hexutil.Big)(call.MaxPriorityFeePerGas).String()
+	}
+	if call.AccessList != nil {
+		args["accessList"] = call.AccessList
+	}
+	params := []interface{}{
+		args, blk,
+	}
+
+	rpcResp, err := c.post("eth_estimateGas", params, nil)
 	if err != nil {
 		return 0, fmt.Errorf("RPC call failed: %w", err)
 	}
@@ -180,7 +340,18 @@ func (c *Client) GetTxByHash(hash string) (map[string]interface{}, error) {
 		hash,
 	}
 
-	rpcResp, err := rpcPost(c.RpcUrl, "eth_getTransactionByHash", params)
+	// a mined transaction never changes, so it's cached by hash alone
+	key := []byte(fmt.Sprintf("%d/tx/%s", c.ChainId, strings.ToLower(hash)))
+	if c.Cache != nil {
+		if raw, ok := c.Cache.get(key); ok {
+			var result map[string]interface{}
+			if err := json.Unmarshal(raw, &result); err == nil {
+				return result, nil
+			}
+		}
+	}
+
+	rpcResp, err := c.post("eth_getTransactionByHash", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("RPC call failed: %w", err)
 	}
@@ -194,9 +365,66 @@ func (c *Client) GetTxByHash(hash string) (map[string]interface{}, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tx: %w", err)
 	}
+
+	if c.Cache != nil && result != nil && result["blockNumber"] != nil {
+		if err := c.Cache.put(key, rpcResp.Result); err != nil {
+			return nil, err
+		}
+	}
 	return result, nil
 }
 
+// GetTransactionReceipt returns the receipt of the transaction, nil while it's
+// pending.
+func (c *Client) GetTransactionReceipt(hash string) (map[string]interface{}, error) {
+	params := []interface{}{
+		hash,
+	}
+
+	// like the transaction, a receipt is there for good once it's returned
+	key := []byte(fmt.Sprintf("%d/receipt/%s", c.ChainId, strings.ToLower(hash)))
+	rpcResp, err := c.post("eth_getTransactionReceipt", params, key)
+	if err != nil {
+		return nil, fmt.Errorf("RPC call failed: %w", err)
+	}
+
+	if rpcResp.Err != nil {
+		return nil, fmt.Errorf("RPC error: %s", rpcResp.Err.Error())
+	}
+
+	var result map[string]interface{}
+	err = json.Unmarshal(rpcResp.Result, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt: %w", err)
+	}
+	return result, nil
+}
+
+// post sends method to the endpoint. When key is set the result is served
+// from the cache if present, and stored there otherwise.
+func (c *Client) post(method string, params []interface{}, key []byte) (*Response, error) {
+	if key != nil && c.Cache != nil {
+		if result, ok := c.Cache.get(key); ok {
+			return &Response{ID: 1, JSONRpc: "2.0", Result: result}, nil
+		}
+	}
+	if c.Offline {
+		return nil, fmt.Errorf("%w: %s %v", ErrCacheMiss, method, params)
+	}
+
+	rpcResp, err := rpcPost(c.RpcUrl, method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil && c.Cache != nil && rpcResp.Err == nil && len(rpcResp.Result) > 0 && string(rpcResp.Result) != "null" {
+		if err := c.Cache.put(key, rpcResp.Result); err != nil {
+			return nil, err
+		}
+	}
+	return rpcResp, nil
+}
+
 func rpcPost(rpcRpcUrl, method string, params []interface{}) (*Response, error) {
 	payload := Request{
 		ID:      1,
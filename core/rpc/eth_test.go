@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestBlockNumberArg(t *testing.T) {
+	var blocks []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, req.Params[0].(string))
+		w.Write([]byte(`{"id":1,"jsonrpc":"2.0","result":{"hash":"0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"}}`))
+	}))
+	defer srv.Close()
+	clt := &Client{RpcUrl: srv.URL, ChainId: 1}
+
+	for _, blk := range []string{"0x0", "0x00", "0x10", "latest", "", "safe"} {
+		if _, err := clt.GetBlockByNumber(blk, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the genesis block is read by BLOCKHASH(0) of a fork
+	if _, err := clt.ForkAt(new(big.Int)).GetBlockHash(0); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0x0", "0x0", "0x10", "latest", "latest", "safe", "0x0"}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("request %d: have block %s, want %s", i, blocks[i], want[i])
+		}
+	}
+	// a tag isn't rewritten into an other block
+	for _, blk := range []string{"pending", "0xg", "16"} {
+		if _, err := clt.GetBlockByNumber(blk, false); err == nil {
+			t.Errorf("block %s accepted", blk)
+		}
+	}
+	if len(blocks) != len(want) {
+		t.Errorf("have %d requests, want %d", len(blocks), len(want))
+	}
+	if blk := clt.ForkAt(new(big.Int)).blk; blk != "0x0" {
+		t.Errorf("fork at genesis: have block %s, want 0x0", blk)
+	}
+}
+
+func TestGetStorageHash(t *testing.T) {
+	var req Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(`{"id":1,"jsonrpc":"2.0","result":{"storageHash":"0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"}}`))
+	}))
+	defer srv.Close()
+	clt := &Client{RpcUrl: srv.URL, ChainId: 1}
+
+	root, err := clt.ForkAt(big.NewInt(16)).GetStorageRoot(common.HexToAddress("0x01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != types.EmptyRootHash {
+		t.Errorf("have root %x, want %x", root, types.EmptyRootHash)
+	}
+	if req.Method != "eth_getProof" || len(req.Params) != 3 || req.Params[2] != "0x10" {
+		t.Errorf("have request %s %v", req.Method, req.Params)
+	}
+}
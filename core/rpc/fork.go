@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/uint256"
+)
+
+// ForkSource serves the state of a single block from the RPC endpoint, it
+// satisfies evm.ForkStateSource.
+type ForkSource struct {
+	client *Client
+	blk    string
+}
+
+// ForkAt returns a ForkSource reading the state at blockNumber, a nil block
+// number reads from the latest block.
+func (c *Client) ForkAt(blockNumber *big.Int) *ForkSource {
+	blk := "latest"
+	if blockNumber != nil {
+		blk = hexutil.EncodeBig(blockNumber)
+	}
+	return &ForkSource{client: c, blk: blk}
+}
+
+func (f *ForkSource) GetCode(addr common.Address) ([]byte, error) {
+	return f.client.GetCode(addr.Hex(), f.blk)
+}
+
+func (f *ForkSource) GetBalance(addr common.Address) (*uint256.Int, error) {
+	balance, err := f.client.GetBalance(addr.Hex(), f.blk)
+	if err != nil {
+		return nil, err
+	}
+	result, overflow := uint256.FromBig(balance)
+	if overflow {
+		return nil, fmt.Errorf("balance of %s overflows 256 bits", addr.Hex())
+	}
+	return result, nil
+}
+
+func (f *ForkSource) GetNonce(addr common.Address) (uint64, error) {
+	return f.client.GetNonce(addr.Hex(), f.blk)
+}
+
+func (f *ForkSource) GetStorageAt(addr common.Address, slot common.Hash) (common.Hash, error) {
+	return f.client.GetStorageAt(addr.Hex(), slot.Hex(), f.blk)
+}
+
+func (f *ForkSource) GetStorageRoot(addr common.Address) (common.Hash, error) {
+	return f.client.GetStorageHash(addr.Hex(), f.blk)
+}
+
+func (f *ForkSource) GetBlockHash(number uint64) (common.Hash, error) {
+	block, err := f.client.GetBlockByNumber(hexutil.EncodeUint64(number), false)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	hash, ok := block["hash"].(string)
+	if !ok {
+		return common.Hash{}, fmt.Errorf("block %d has no hash", number)
+	}
+	return common.HexToHash(hash), nil
+}
@@ -0,0 +1,426 @@
+package sourcemap
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sources holds the compiled contracts whose executed code is mapped back to
+// their sources.
+type Sources struct {
+	// Root is the directory the paths of the sources are relative to when
+	// their content isn't in the artifacts, the current one when empty
+	Root string
+
+	contracts []*Contract
+}
+
+// Contract is a compiled contract, its Creation code runs the constructor and
+// returns its Runtime code.
+type Contract struct {
+	Name     string
+	Path     string
+	Runtime  *Bytecode
+	Creation *Bytecode
+}
+
+// Bytecode is the code of a contract along with its source map.
+type Bytecode struct {
+	Contract *Contract
+
+	code []byte
+	// bytes left out of the comparison with the deployed code: the library
+	// addresses, immutables and metadata
+	mask         []bool
+	entries      []entry
+	instructions map[uint64]int
+	files        map[int]*sourceFile
+}
+
+func NewSources() *Sources {
+	return &Sources{}
+}
+
+// Contracts returns the contracts loaded.
+func (s *Sources) Contracts() []*Contract {
+	return s.contracts
+}
+
+// Match returns the code of the contract that code was compiled from, nil if
+// there is none. The code run by a contract creation is its creation code
+// followed by the arguments of the constructor.
+func (s *Sources) Match(code []byte, creation bool) *Bytecode {
+	if s == nil || len(code) == 0 {
+		return nil
+	}
+	for _, contract := range s.contracts {
+		bytecode := contract.Runtime
+		if creation {
+			bytecode = contract.Creation
+		}
+		if bytecode != nil && bytecode.matches(code, creation) {
+			return bytecode
+		}
+	}
+	return nil
+}
+
+func (b *Bytecode) matches(code []byte, prefix bool) bool {
+	if len(code) != len(b.code) && (!prefix || len(code) < len(b.code)) {
+		return false
+	}
+	for i, c := range b.code {
+		if !b.mask[i] && code[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// Locate returns the source of the instruction at pc, nil when it has none,
+// as for the code generated by the compiler.
+func (b *Bytecode) Locate(pc uint64) *Location {
+	if b == nil {
+		return nil
+	}
+	i, ok := b.instructions[pc]
+	if !ok || i >= len(b.entries) {
+		return nil
+	}
+	e := b.entries[i]
+	file := b.files[e.File]
+	if file == nil {
+		return nil
+	}
+	location := &Location{File: file.Path, Jump: e.Jump}
+	location.Line, location.Column, location.Text = file.position(e.Start)
+	return location
+}
+
+// LoadDir loads the artifacts found in dir and its subdirectories: the
+// build-info files of Hardhat and Foundry, the outputs of solc --standard-json
+// and the contract artifacts of Foundry. The other JSON files are skipped.
+func (s *Sources) LoadDir(dir string) error {
+	var foundry []*foundryArtifact
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".json") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		artifact, err := s.load(data)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		if artifact != nil {
+			artifact.name = strings.TrimSuffix(entry.Name(), filepath.Ext(path))
+			foundry = append(foundry, artifact)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.addFoundry(foundry)
+}
+
+// LoadFile loads the artifact at path, a build-info file, an output of solc
+// --standard-json or a contract artifact of Foundry.
+func (s *Sources) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	artifact, err := s.load(data)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	if artifact == nil {
+		return nil
+	}
+	artifact.name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return s.addFoundry([]*foundryArtifact{artifact})
+}
+
+type compilerOutput struct {
+	Contracts map[string]map[string]struct {
+		EVM struct {
+			Bytecode         bytecodeOutput `json:"bytecode"`
+			DeployedBytecode bytecodeOutput `json:"deployedBytecode"`
+		} `json:"evm"`
+	} `json:"contracts"`
+	Sources map[string]struct {
+		ID int `json:"id"`
+	} `json:"sources"`
+}
+
+type compilerInput struct {
+	Sources map[string]struct {
+		Content string `json:"content"`
+	} `json:"sources"`
+}
+
+type bytecodeOutput struct {
+	Object              string `json:"object"`
+	SourceMap           string `json:"sourceMap"`
+	ImmutableReferences map[string][]struct {
+		Start  int `json:"start"`
+		Length int `json:"length"`
+	} `json:"immutableReferences"`
+	GeneratedSources []struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Contents string `json:"contents"`
+	} `json:"generatedSources"`
+}
+
+// foundryArtifact is the artifact of a contract compiled by Foundry, the path
+// of its source and its id are needed to resolve the files of the source maps
+// of the others.
+type foundryArtifact struct {
+	name             string
+	Bytecode         bytecodeOutput `json:"bytecode"`
+	DeployedBytecode bytecodeOutput `json:"deployedBytecode"`
+	ID               *int           `json:"id"`
+	AST              struct {
+		AbsolutePath string `json:"absolutePath"`
+	} `json:"ast"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// compilationTarget returns the path and the name of the contract of the
+// artifact, from its metadata which older versions of Foundry keep as a string.
+func (a *foundryArtifact) compilationTarget() (string, string, bool) {
+	metadata := a.Metadata
+	var encoded string
+	if err := json.Unmarshal(metadata, &encoded); err == nil {
+		metadata = json.RawMessage(encoded)
+	}
+	var decoded struct {
+		Settings struct {
+			CompilationTarget map[string]string `json:"compilationTarget"`
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(metadata, &decoded); err != nil {
+		return "", "", false
+	}
+	for path, name := range decoded.Settings.CompilationTarget {
+		return path, name, true
+	}
+	return "", "", false
+}
+
+// load adds the contracts of a build-info file or of a compiler output. The
+// contract artifacts of Foundry are returned instead, to be added once all of
+// them are known.
+func (s *Sources) load(data []byte) (*foundryArtifact, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// not an artifact
+		return nil, nil
+	}
+	switch {
+	case fields["input"] != nil && fields["output"] != nil:
+		var input compilerInput
+		if err := json.Unmarshal(fields["input"], &input); err != nil {
+			return nil, err
+		}
+		var output compilerOutput
+		if err := json.Unmarshal(fields["output"], &output); err != nil {
+			return nil, err
+		}
+		return nil, s.addCompilation(&output, &input)
+	case fields["contracts"] != nil && fields["sources"] != nil:
+		var output compilerOutput
+		if err := json.Unmarshal(data, &output); err != nil {
+			return nil, err
+		}
+		return nil, s.addCompilation(&output, nil)
+	case fields["deployedBytecode"] != nil && fields["ast"] != nil:
+		var artifact foundryArtifact
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return nil, err
+		}
+		// an artifact without source map can't be mapped back to its sources
+		if artifact.DeployedBytecode.SourceMap == "" || artifact.ID == nil {
+			return nil, nil
+		}
+		return &artifact, nil
+	}
+	return nil, nil
+}
+
+// addCompilation adds the contracts of a compiler output, the sources are
+// read from input when it has them and from the disk otherwise.
+func (s *Sources) addCompilation(output *compilerOutput, input *compilerInput) error {
+	files := make(map[int]*sourceFile)
+	for path, source := range output.Sources {
+		var content string
+		if input != nil {
+			content = input.Sources[path].Content
+		}
+		if content == "" {
+			content = s.readSource(path)
+		}
+		files[source.ID] = newSourceFile(path, content)
+	}
+	for path, contracts := range output.Contracts {
+		for name, contract := range contracts {
+			if err := s.addContract(name, path, files, contract.EVM.Bytecode, contract.EVM.DeployedBytecode); err != nil {
+				return fmt.Errorf("contract %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addFoundry adds contract artifacts of Foundry, which must all come from the
+// same compilation as they share the ids of the sources.
+func (s *Sources) addFoundry(artifacts []*foundryArtifact) error {
+	files := make(map[int]*sourceFile)
+	for _, artifact := range artifacts {
+		if _, ok := files[*artifact.ID]; !ok {
+			path := artifact.AST.AbsolutePath
+			files[*artifact.ID] = newSourceFile(path, s.readSource(path))
+		}
+	}
+	for _, artifact := range artifacts {
+		name, path := artifact.name, artifact.AST.AbsolutePath
+		if targetPath, targetName, ok := artifact.compilationTarget(); ok {
+			name, path = targetName, targetPath
+		}
+		if err := s.addContract(name, path, files, artifact.Bytecode, artifact.DeployedBytecode); err != nil {
+			return fmt.Errorf("contract %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sources) addContract(name, path string, files map[int]*sourceFile, creation, runtime bytecodeOutput) error {
+	contract := &Contract{Name: name, Path: path}
+	var err error
+	if contract.Runtime, err = newBytecode(contract, runtime, files); err != nil {
+		return err
+	}
+	if contract.Creation, err = newBytecode(contract, creation, files); err != nil {
+		return err
+	}
+	// interfaces and abstract contracts have no code
+	if contract.Runtime != nil || contract.Creation != nil {
+		s.contracts = append(s.contracts, contract)
+	}
+	return nil
+}
+
+// newBytecode decodes the code of a compiler output, nil when it's empty or
+// has no source map.
+func newBytecode(contract *Contract, output bytecodeOutput, files map[int]*sourceFile) (*Bytecode, error) {
+	if output.SourceMap == "" {
+		return nil, nil
+	}
+	code, mask, err := decodeObject(output.Object)
+	if err != nil || len(code) == 0 {
+		return nil, err
+	}
+	entries, err := parseSourceMap(output.SourceMap)
+	if err != nil {
+		return nil, err
+	}
+	for _, references := range output.ImmutableReferences {
+		for _, ref := range references {
+			for i := ref.Start; i < ref.Start+ref.Length && i < len(mask); i++ {
+				mask[i] = true
+			}
+		}
+	}
+	maskMetadata(code, mask)
+
+	if len(output.GeneratedSources) > 0 {
+		all := make(map[int]*sourceFile, len(files)+len(output.GeneratedSources))
+		for id, file := range files {
+			all[id] = file
+		}
+		for _, source := range output.GeneratedSources {
+			all[source.ID] = newSourceFile(source.Name, source.Contents)
+		}
+		files = all
+	}
+	return &Bytecode{
+		Contract:     contract,
+		code:         code,
+		mask:         mask,
+		entries:      entries,
+		instructions: instructions(code),
+		files:        files,
+	}, nil
+}
+
+// decodeObject decodes the hex of a compiled code, the placeholders of the
+// library addresses left to link being masked.
+func decodeObject(object string) ([]byte, []bool, error) {
+	object = strings.TrimPrefix(object, "0x")
+	var (
+		code []byte
+		mask []bool
+	)
+	for i := 0; i < len(object); i += 2 {
+		// __$hash$__ or __LibraryName___, both the size of an address
+		if strings.HasPrefix(object[i:], "__") && len(object) >= i+40 {
+			code = append(code, make([]byte, 20)...)
+			mask = append(mask, slices.Repeat([]bool{true}, 20)...)
+			i += 38
+			continue
+		}
+		if i+2 > len(object) {
+			return nil, nil, fmt.Errorf("odd length bytecode")
+		}
+		b, err := hex.DecodeString(object[i : i+2])
+		if err != nil {
+			return nil, nil, err
+		}
+		code = append(code, b[0])
+		mask = append(mask, false)
+	}
+	return code, mask, nil
+}
+
+// maskMetadata masks the CBOR encoded metadata appended to code, its length
+// being held by the last two bytes, as it changes with the build environment.
+func maskMetadata(code []byte, mask []bool) {
+	if len(code) < 2 {
+		return
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	// the metadata is a map, whose CBOR encoding starts with 0xa1 to 0xb7
+	start := len(code) - 2 - length
+	if start < 0 || code[start] < 0xa1 || code[start] > 0xb7 {
+		return
+	}
+	for i := start; i < len(code); i++ {
+		mask[i] = true
+	}
+}
+
+// readSource reads the content of the source at path, empty if it can't be
+// found.
+func (s *Sources) readSource(path string) string {
+	if path == "" {
+		return ""
+	}
+	if !filepath.IsAbs(path) && s.Root != "" {
+		path = filepath.Join(s.Root, path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
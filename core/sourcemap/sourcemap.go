@@ -0,0 +1,124 @@
+// Package sourcemap maps the program counters of compiled contracts back to
+// their Solidity sources, through the source maps of the compiler.
+package sourcemap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Location is the source of an instruction. Line and Column start at 1, they
+// are 0 when the content of File isn't known. Jump is i for a jump into a
+// function, o for a jump out of one and - otherwise, and Text is the line of
+// source holding the start of the instruction.
+type Location struct {
+	File   string
+	Line   int
+	Column int
+	Jump   string
+	Text   string
+}
+
+func (l *Location) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// entry is an instruction of a source map, File is -1 for the code generated
+// by the compiler with no source.
+type entry struct {
+	Start  int
+	Length int
+	File   int
+	Jump   string
+}
+
+// parseSourceMap decompresses a source map, a list of s:l:f:j:m entries
+// separated by semicolons where the missing fields repeat the previous entry.
+func parseSourceMap(sourceMap string) ([]entry, error) {
+	if sourceMap == "" {
+		return nil, nil
+	}
+	var (
+		entries []entry
+		last    = entry{File: -1, Jump: "-"}
+	)
+	for i, item := range strings.Split(sourceMap, ";") {
+		fields := strings.Split(item, ":")
+		for j, field := range fields {
+			if field == "" {
+				continue
+			}
+			var err error
+			switch j {
+			case 0:
+				last.Start, err = strconv.Atoi(field)
+			case 1:
+				last.Length, err = strconv.Atoi(field)
+			case 2:
+				last.File, err = strconv.Atoi(field)
+			case 3:
+				last.Jump = field
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid source map entry %d: %w", i, err)
+			}
+		}
+		entries = append(entries, last)
+	}
+	return entries, nil
+}
+
+// instructions maps the offset of every instruction of code to its index, the
+// source maps being indexed by instruction.
+func instructions(code []byte) map[uint64]int {
+	indexes := make(map[uint64]int)
+	for pc, i := 0, 0; pc < len(code); i++ {
+		indexes[uint64(pc)] = i
+		op := code[pc]
+		pc++
+		// PUSH1 to PUSH32 are followed by their operand
+		if op >= 0x60 && op <= 0x7f {
+			pc += int(op-0x60) + 1
+		}
+	}
+	return indexes
+}
+
+// sourceFile is a source of a compilation, Content is empty when it couldn't
+// be found.
+type sourceFile struct {
+	Path    string
+	Content string
+	// offsets of the start of every line
+	lines []int
+}
+
+func newSourceFile(path, content string) *sourceFile {
+	file := &sourceFile{Path: path, Content: content, lines: []int{0}}
+	for i, c := range content {
+		if c == '\n' {
+			file.lines = append(file.lines, i+1)
+		}
+	}
+	return file
+}
+
+// position returns the line and the column of offset, and the text of the
+// line, starting at 1.
+func (f *sourceFile) position(offset int) (int, int, string) {
+	if f.Content == "" || offset < 0 || offset > len(f.Content) {
+		return 0, 0, ""
+	}
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	end := len(f.Content)
+	if line+1 < len(f.lines) {
+		end = f.lines[line+1]
+	}
+	text := strings.TrimSpace(f.Content[f.lines[line]:end])
+	return line + 1, offset - f.lines[line] + 1, text
+}
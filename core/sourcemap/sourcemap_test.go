@@ -0,0 +1,91 @@
+package sourcemap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const source = `contract A {
+    uint x;
+    function f() public {
+        x = 1;
+    }
+}
+`
+
+// SSTORE(0, 1), STOP, followed by metadata; the first push is an immutable
+const standardOutput = `{
+	"contracts": {"src/A.sol": {"A": {"evm": {
+		"deployedBytecode": {
+			"object": "600160005500a101020003",
+			"sourceMap": "59:5:0:-:0;;;25:48:0:o;",
+			"immutableReferences": {"3": [{"start": 1, "length": 1}]}
+		}
+	}}}},
+	"sources": {"src/A.sol": {"id": 0}}
+}`
+
+func TestParseSourceMap(t *testing.T) {
+	entries, err := parseSourceMap("1:2:0;;3::-1:i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []entry{{1, 2, 0, "-"}, {1, 2, 0, "-"}, {3, 2, -1, "i"}}
+	if len(entries) != len(want) {
+		t.Fatalf("have %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d: have %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestSourcesLocate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "A.sol"), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "output.json"), []byte(standardOutput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sources := NewSources()
+	sources.Root = dir
+	if err := sources.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the immutable and the metadata differ from the compiled code
+	bytecode := sources.Match([]byte{0x60, 0x07, 0x60, 0x00, 0x55, 0x00, 0xa1, 0x09, 0x09, 0x00, 0x03}, false)
+	if bytecode == nil || bytecode.Contract.Name != "A" {
+		t.Fatalf("deployed code not matched: %+v", bytecode)
+	}
+	if sources.Match([]byte{0x60, 0x07, 0x60, 0x01, 0x55, 0x00, 0xa1, 0x09, 0x09, 0x00, 0x03}, false) != nil {
+		t.Errorf("matched a different code")
+	}
+
+	if loc := bytecode.Locate(4); loc == nil || loc.String() != "src/A.sol:4:9" || loc.Text != "x = 1;" {
+		t.Errorf("SSTORE: have %+v", loc)
+	}
+	if loc := bytecode.Locate(5); loc == nil || loc.Line != 3 || loc.Jump != "o" || loc.Text != "function f() public {" {
+		t.Errorf("STOP: have %+v", loc)
+	}
+	// the operand of a push isn't an instruction
+	if loc := bytecode.Locate(1); loc != nil {
+		t.Errorf("push operand: have %+v", loc)
+	}
+}
+
+func TestDecodeObject(t *testing.T) {
+	code, mask, err := decodeObject("0x73__$0123456789abcdef0123456789abcdef01$__00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 22 || mask[0] || !mask[1] || !mask[20] || mask[21] {
+		t.Errorf("library placeholder: have %x masked %v", code, mask)
+	}
+}
@@ -0,0 +1,385 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var (
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	labelStyle    = lipgloss.NewStyle().Bold(true)
+	matchStyle    = lipgloss.NewStyle().Underline(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	helpStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+)
+
+const browserHelp = "↑/↓ move • →/← expand/collapse • enter toggle • p parent • ]/[ next/previous sibling • e/c expand/collapse all • / search • n/N next/previous match • f filter matches • esc clear search • d step through opcodes • pgup/pgdn scroll details • q quit"
+
+// browser shows the call tree on the left and the details of the selected
+// node on the right, or the opcodes of a frame while debugging it.
+type browser struct {
+	tree     *tree
+	detail   viewport.Model
+	debugger *debugger
+	// search is focused while the query is typed
+	search textinput.Model
+	ready  bool
+	width  int
+	height int
+	// first row of the tree shown
+	offset int
+}
+
+func newBrowser(trace Event) browser {
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "address, selector, function, event or error"
+	return browser{tree: newTree(trace), search: search}
+}
+
+func (b browser) Init() tea.Cmd {
+	return nil
+}
+
+func (b browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if b.debugger != nil {
+			return b.updateDebugger(msg)
+		}
+		if b.search.Focused() {
+			return b.updateSearch(msg)
+		}
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return b, tea.Quit
+		case "d":
+			if n := b.tree.selected(); n != nil && n.frame != nil {
+				b.debugger = newDebugger(n.frame)
+			}
+			return b, nil
+		case "up", "k":
+			b.tree.up()
+		case "down", "j":
+			b.tree.down()
+		case "right", "l":
+			b.tree.expand()
+		case "left", "h":
+			b.tree.collapse()
+		case "enter", " ":
+			b.tree.toggle()
+		case "p":
+			b.tree.parent()
+		case "]":
+			b.tree.sibling(1)
+		case "[":
+			b.tree.sibling(-1)
+		case "/":
+			b.search.SetValue(b.tree.query)
+			b.search.CursorEnd()
+			return b, b.search.Focus()
+		case "n":
+			b.tree.findMatch(1, false)
+		case "N":
+			b.tree.findMatch(-1, false)
+		case "f":
+			b.tree.setFilter(!b.tree.filter)
+		case "esc":
+			b.tree.filter = false
+			b.tree.search("")
+		case "g", "home":
+			b.tree.top()
+		case "G", "end":
+			b.tree.bottom()
+		case "e":
+			b.tree.setExpanded(true)
+		case "c":
+			b.tree.setExpanded(false)
+		case "pgup", "pgdown":
+			b.detail, cmd = b.detail.Update(msg)
+			return b, cmd
+		}
+		b.scrollToCursor()
+		b.detail.SetContent(b.detailContent())
+		b.detail.GotoTop()
+	case tea.WindowSizeMsg:
+		b.width, b.height = msg.Width, msg.Height
+		if !b.ready {
+			b.detail = viewport.New(b.detailWidth(), b.bodyHeight())
+			b.ready = true
+		} else {
+			b.detail.Width, b.detail.Height = b.detailWidth(), b.bodyHeight()
+		}
+		b.scrollToCursor()
+		b.detail.SetContent(b.detailContent())
+	}
+	return b, nil
+}
+
+func (b browser) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		b.search.Blur()
+		b.tree.search(b.search.Value())
+		b.tree.findMatch(1, true)
+	case "esc":
+		b.search.Blur()
+	case "ctrl+c":
+		return b, tea.Quit
+	default:
+		var cmd tea.Cmd
+		b.search, cmd = b.search.Update(msg)
+		return b, cmd
+	}
+	b.scrollToCursor()
+	b.detail.SetContent(b.detailContent())
+	b.detail.GotoTop()
+	return b, nil
+}
+
+func (b browser) updateDebugger(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return b, tea.Quit
+	case "esc", "d":
+		b.debugger = nil
+	case "up", "k", "left", "h":
+		b.debugger.move(-1)
+	case "down", "j", "right", "l":
+		b.debugger.move(1)
+	case "pgup":
+		b.debugger.move(-10)
+	case "pgdown":
+		b.debugger.move(10)
+	case "g", "home":
+		b.debugger.goTo(0)
+	case "G", "end":
+		b.debugger.goTo(len(b.debugger.frame.OpCodes) - 1)
+	case "[":
+		b.debugger.scrollMemoryBy(-1)
+	case "]":
+		b.debugger.scrollMemoryBy(1)
+	}
+	return b, nil
+}
+
+func (b browser) View() string {
+	if !b.ready {
+		return "\n  Initializing..."
+	}
+	if b.debugger != nil {
+		body := b.debugger.view(b.width, b.bodyHeight())
+		footer := helpStyle.MaxWidth(b.width).Render(debuggerHelp)
+		return fmt.Sprintf("%s\n%s\n%s", header("Opcode Debugger", b.width), body, footer)
+	}
+	title := "Trace Viewer"
+	if status := b.searchStatus(); status != "" {
+		title += " " + status
+	}
+	body := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().Width(b.treeWidth()).Height(b.bodyHeight()).Render(b.treeView()),
+		baseStyle.BorderTop(false).BorderBottom(false).BorderRight(false).Render(b.detail.View()),
+	)
+	footer := helpStyle.MaxWidth(b.width).Render(browserHelp)
+	if b.search.Focused() {
+		footer = b.search.View()
+	}
+	return fmt.Sprintf("%s\n%s\n%s", header(title, b.width), body, footer)
+}
+
+func header(title string, width int) string {
+	return lipgloss.JoinHorizontal(lipgloss.Center, title, strings.Repeat("─", max(0, width-lipgloss.Width(title))))
+}
+
+// searchStatus describes the search, empty when there is none.
+func (b browser) searchStatus() string {
+	if b.tree.query == "" {
+		return ""
+	}
+	status := fmt.Sprintf("/%s: no match", b.tree.query)
+	if len(b.tree.matches) > 0 {
+		status = fmt.Sprintf("/%s: %d matches", b.tree.query, len(b.tree.matches))
+		if i := b.tree.matchIndex(); i >= 0 {
+			status = fmt.Sprintf("/%s: match %d of %d", b.tree.query, i+1, len(b.tree.matches))
+		}
+	}
+	if b.tree.filtering() {
+		status += ", filtered"
+	}
+	return status
+}
+
+func (b browser) treeWidth() int {
+	return b.width * 3 / 5
+}
+
+func (b browser) detailWidth() int {
+	// the left border of the pane takes a column
+	return max(0, b.width-b.treeWidth()-1)
+}
+
+func (b browser) bodyHeight() int {
+	// header and footer lines
+	return max(0, b.height-2)
+}
+
+// scrollToCursor moves the tree so that the selected row is visible.
+func (b *browser) scrollToCursor() {
+	height := b.bodyHeight()
+	if b.tree.cursor < b.offset {
+		b.offset = b.tree.cursor
+	}
+	if height > 0 && b.tree.cursor >= b.offset+height {
+		b.offset = b.tree.cursor - height + 1
+	}
+}
+
+func (b browser) treeView() string {
+	var lines []string
+	end := min(len(b.tree.rows), b.offset+b.bodyHeight())
+	for i := b.offset; i < end; i++ {
+		n := b.tree.rows[i]
+		marker := "  "
+		if len(n.children) > 0 && n.expanded {
+			marker = "▾ "
+		} else if len(n.children) > 0 {
+			marker = "▸ "
+		}
+		var line string
+		if n.frame != nil {
+			line = frameLine(*n.frame)
+		} else {
+			line = logLine(*n.log)
+		}
+		line = strings.Repeat("  ", n.depth) + marker + line
+		switch {
+		case i == b.tree.cursor:
+			// the styles of the line would end the highlight early
+			line = selectedStyle.Render(ansi.Strip(line))
+		case n.match:
+			line = matchStyle.Render(ansi.Strip(line))
+		}
+		lines = append(lines, ansi.Truncate(line, b.treeWidth(), ""))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// detailContent describes the selected node in full.
+func (b browser) detailContent() string {
+	n := b.tree.selected()
+	if n == nil {
+		return ""
+	}
+	var fields [][2]string
+	if n.log != nil {
+		fields = logDetails(n.log)
+	} else {
+		fields = frameDetails(n.frame)
+	}
+	width := max(1, b.detailWidth())
+	var content strings.Builder
+	for _, field := range fields {
+		content.WriteString(labelStyle.Render(field[0]) + "\n")
+		content.WriteString(lipgloss.NewStyle().Width(width).Render(field[1]) + "\n\n")
+	}
+	return content.String()
+}
+
+func frameDetails(frame *Node) [][2]string {
+	enter, exit := frame.OnEnter, frame.OnExit
+	fields := [][2]string{
+		{"Type", fmt.Sprintf("%v", enter["Type"])},
+		{"From", labeled(fmt.Sprintf("%v", enter["From"]), enter["FromLabel"])},
+		{"To", labeled(fmt.Sprintf("%v", enter["To"]), enter["ToLabel"])},
+		{"Value", fmt.Sprintf("%v", enter["Value"])},
+		{"Gas", fmt.Sprintf("%v", enter["Gas"])},
+	}
+	if exit != nil {
+		fields = append(fields, [2]string{"Gas used", fmt.Sprintf("%v", exit["GasUsed"])})
+	}
+	if frame.Contract != "" {
+		fields = append(fields, [2]string{"Contract", frame.Contract})
+	}
+	if frame.Call != nil {
+		call := frame.Call.Name
+		if frame.Call.Guessed {
+			call += " (guessed from the selector)"
+		}
+		fields = append(fields, [2]string{"Function", call})
+		for _, arg := range frame.Call.Args {
+			fields = append(fields, [2]string{"  " + argLabel(arg), labeled(arg.Value, arg.Label)})
+		}
+		for _, ret := range frame.Call.Returns {
+			fields = append(fields, [2]string{"  returns " + argLabel(ret), labeled(ret.Value, ret.Label)})
+		}
+	}
+	fields = append(fields, [2]string{"Input", "0x" + fmt.Sprintf("%v", enter["Input"])})
+	if exit == nil {
+		return fields
+	}
+	fields = append(fields, [2]string{"Output", "0x" + fmt.Sprintf("%v", exit["Output"])})
+	if err, _ := exit["Err"].(string); err != "" && err != "<nil>" {
+		fields = append(fields, [2]string{"Error", errorStyle.Render(err)})
+	}
+	if revert, ok := exit["Revert"].(map[string]interface{}); ok {
+		fields = append(fields, [2]string{"Revert reason", errorStyle.Render(fmt.Sprintf("%v", revert["Reason"]))})
+	}
+	return fields
+}
+
+func logDetails(log *Log) [][2]string {
+	fields := [][2]string{{"Address", labeled(log.Address, log.AddressLabel)}}
+	if log.Event != nil {
+		event := log.Event.Name
+		if log.Event.Guessed {
+			event += " (guessed from the topic)"
+		}
+		fields = append(fields, [2]string{"Event", event})
+		for _, arg := range log.Event.Args {
+			value := labeled(arg.Value, arg.Label)
+			if arg.Hashed {
+				value = "keccak256 " + value
+			}
+			fields = append(fields, [2]string{"  " + argLabel(arg), value})
+		}
+	}
+	for i, topic := range log.Topics {
+		fields = append(fields, [2]string{fmt.Sprintf("Topic %d", i), topic})
+	}
+	fields = append(fields, [2]string{"Data", "0x" + log.Data})
+	if log.Discarded {
+		fields = append(fields, [2]string{"Discarded", "emitted by a reverted frame"})
+	}
+	return fields
+}
+
+// labeled appends its label to value, if it has one.
+func labeled(value string, label interface{}) string {
+	if label, _ := label.(string); label != "" {
+		return fmt.Sprintf("%s (%s)", value, label)
+	}
+	return value
+}
+
+func argLabel(arg Arg) string {
+	if arg.Name == "" {
+		return arg.Type
+	}
+	return fmt.Sprintf("%s %s", arg.Type, arg.Name)
+}
+
+// DisplayTrace opens the interactive call tree browser on trace.
+func DisplayTrace(trace Event) {
+	if err := tea.NewProgram(newBrowser(trace), tea.WithAltScreen()).Start(); err != nil {
+		fmt.Println("Error running program:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,307 @@
+package tui
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var (
+	stackTopStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true)
+	sourceStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("14")).Bold(true)
+	changedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Bold(true)
+	writeStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("13"))
+)
+
+const debuggerHelp = "↑/↓ step • pgup/pgdn step 10 • g/G first/last step • [/] scroll memory • esc back to the tree • q quit"
+
+// memoryRowSize is the number of bytes shown on a row of the memory pane.
+const memoryRowSize = 16
+
+// debugger steps through the opcodes executed by a frame.
+type debugger struct {
+	frame *Node
+	step  int
+	// first memory row shown
+	memoryOffset int
+}
+
+func newDebugger(frame *Node) *debugger {
+	d := &debugger{frame: frame}
+	d.scrollMemory()
+	return d
+}
+
+// move steps by n opcodes, backward when n is negative.
+func (d *debugger) move(n int) {
+	d.goTo(d.step + n)
+}
+
+func (d *debugger) goTo(step int) {
+	d.step = max(0, min(step, len(d.frame.OpCodes)-1))
+	d.scrollMemory()
+}
+
+// scrollMemory shows the first memory row changed by the previous step.
+func (d *debugger) scrollMemory() {
+	memory, previous := d.memory()
+	for i := range memory {
+		if i >= len(previous) || memory[i] != previous[i] {
+			d.memoryOffset = i / memoryRowSize
+			return
+		}
+	}
+	d.memoryOffset = min(d.memoryOffset, len(memory)/memoryRowSize)
+}
+
+func (d *debugger) scrollMemoryBy(rows int) {
+	memory, _ := d.memory()
+	d.memoryOffset = max(0, min(d.memoryOffset+rows, (len(memory)-1)/memoryRowSize))
+}
+
+// memory returns the memory before the current step and before the previous
+// one, their difference is what the previous step wrote.
+func (d *debugger) memory() ([]byte, []byte) {
+	if d.step >= len(d.frame.OpCodes) {
+		return nil, nil
+	}
+	memory := memoryBytes(d.frame.OpCodes[d.step].Memory)
+	if d.step == 0 {
+		return memory, memory
+	}
+	return memory, memoryBytes(d.frame.OpCodes[d.step-1].Memory)
+}
+
+// storage returns the slots accessed by the frame up to the current step,
+// with their last value, in the order they were first accessed.
+func (d *debugger) storage() []Storage {
+	var (
+		slots []Storage
+		index = make(map[string]int)
+	)
+	for _, op := range d.frame.OpCodes[:min(d.step+1, len(d.frame.OpCodes))] {
+		if op.Storage == nil {
+			continue
+		}
+		i, ok := index[op.Storage.Slot]
+		if !ok {
+			index[op.Storage.Slot] = len(slots)
+			slots = append(slots, *op.Storage)
+			continue
+		}
+		slots[i].Value = op.Storage.Value
+		slots[i].Write = slots[i].Write || op.Storage.Write
+	}
+	return slots
+}
+
+// internalCall is a call to an internal function of the contract, found from
+// the jumps into and out of functions.
+type internalCall struct {
+	Function string
+	// Caller is where the function was called from
+	Caller *Source
+}
+
+// functionPattern finds the name of a function from the line defining it.
+var functionPattern = regexp.MustCompile(`^(?:function|modifier)\s+(\w+)|^(constructor|fallback|receive)\b`)
+
+// callStack returns the internal functions entered and not yet left before
+// step, the innermost last. The jump into a function is followed by its entry,
+// whose source is the definition of the function.
+func callStack(ops []OpCode, step int) []internalCall {
+	var calls []internalCall
+	for i := 0; i < step && i < len(ops); i++ {
+		source := ops[i].Source
+		if source == nil {
+			continue
+		}
+		switch source.Jump {
+		case "i":
+			name := "?"
+			if i+1 < len(ops) && ops[i+1].Source != nil {
+				name = functionName(ops[i+1].Source.Text)
+			}
+			calls = append(calls, internalCall{Function: name, Caller: source})
+		case "o":
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+		}
+	}
+	return calls
+}
+
+func functionName(text string) string {
+	match := functionPattern.FindStringSubmatch(text)
+	switch {
+	case match == nil:
+		return text
+	case match[1] != "":
+		return match[1]
+	}
+	return match[2]
+}
+
+// memoryBytes joins the memory words of a step, each one written as
+// 0xoffset: hex.
+func memoryBytes(words []string) []byte {
+	var memory []byte
+	for _, word := range words {
+		if i := strings.Index(word, ": "); i >= 0 {
+			word = word[i+2:]
+		}
+		data, err := hex.DecodeString(word)
+		if err != nil {
+			continue
+		}
+		memory = append(memory, data...)
+	}
+	return memory
+}
+
+func (d *debugger) view(width, height int) string {
+	if len(d.frame.OpCodes) == 0 {
+		return "no opcodes recorded for this frame, run the tracer with -opcodes"
+	}
+	op := d.frame.OpCodes[d.step]
+	status := fmt.Sprintf("step %d/%d  pc %d  %s  gas %d  cost %d", d.step+1, len(d.frame.OpCodes), op.PC, op.OpCode, op.Gas, op.Cost)
+	if d.frame.Contract != "" {
+		status += "  in " + d.frame.Contract
+	}
+
+	listWidth := min(32, width/3)
+	paneWidth := max(0, width-listWidth-1)
+	bodyHeight := max(0, height-1)
+
+	source := d.sourcePane(op)
+	stack := d.stackPane(op)
+	storage := d.storagePane()
+	returnData := d.returnDataPane(op, paneWidth)
+	// the memory takes what is left
+	sourceHeight := min(len(source), max(3, bodyHeight/4))
+	stackHeight := min(len(stack), max(2, bodyHeight/4))
+	storageHeight := min(len(storage), max(3, bodyHeight/4))
+	returnHeight := min(len(returnData), 3)
+	memoryHeight := max(2, bodyHeight-sourceHeight-stackHeight-storageHeight-returnHeight)
+	memory := d.memoryPane(memoryHeight - 1)
+
+	var panes []string
+	panes = append(panes, source[:sourceHeight]...)
+	panes = append(panes, stack[:stackHeight]...)
+	panes = append(panes, memory...)
+	panes = append(panes, storage[:storageHeight]...)
+	panes = append(panes, returnData[:returnHeight]...)
+	for i := range panes {
+		panes[i] = ansi.Truncate(panes[i], paneWidth, "")
+	}
+
+	body := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().Width(listWidth).Height(bodyHeight).Render(d.opcodeList(listWidth, bodyHeight)),
+		baseStyle.BorderTop(false).BorderBottom(false).BorderRight(false).
+			Height(bodyHeight).MaxHeight(bodyHeight).
+			Render(strings.Join(panes, "\n")),
+	)
+	return status + "\n" + body
+}
+
+// opcodeList shows the steps around the current one.
+func (d *debugger) opcodeList(width, height int) string {
+	start := max(0, min(d.step-height/2, len(d.frame.OpCodes)-height))
+	end := min(len(d.frame.OpCodes), start+height)
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		op := d.frame.OpCodes[i]
+		line := fmt.Sprintf("%5d %-14s %d", op.PC, op.OpCode, op.Cost)
+		if i == d.step {
+			line = selectedStyle.Render(line)
+		}
+		lines = append(lines, ansi.Truncate(line, width, ""))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sourcePane shows the line of source of the step and the internal functions
+// it's in, innermost first. It's empty when the contract isn't known.
+func (d *debugger) sourcePane(op OpCode) []string {
+	if d.frame.Contract == "" {
+		return nil
+	}
+	if op.Source == nil {
+		return []string{labelStyle.Render("Source") + " generated by the compiler"}
+	}
+	lines := []string{labelStyle.Render("Source ") + op.Source.String(), "  " + sourceStyle.Render(op.Source.Text)}
+	calls := callStack(d.frame.OpCodes, d.step)
+	for i := len(calls) - 1; i >= 0; i-- {
+		lines = append(lines, fmt.Sprintf("  in %s called at %s", calls[i].Function, calls[i].Caller))
+	}
+	return lines
+}
+
+func (d *debugger) stackPane(op OpCode) []string {
+	lines := []string{labelStyle.Render(fmt.Sprintf("Stack (%d)", len(op.Stack)))}
+	for i, value := range op.Stack {
+		line := fmt.Sprintf("%3d %s", i, value)
+		if i == 0 {
+			line = stackTopStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// memoryPane shows rows of the memory in hex and ASCII from the memory offset,
+// the bytes written by the previous step being highlighted.
+func (d *debugger) memoryPane(rows int) []string {
+	memory, previous := d.memory()
+	lines := []string{labelStyle.Render(fmt.Sprintf("Memory (%d bytes)", len(memory)))}
+	for row := d.memoryOffset; row < d.memoryOffset+rows && row*memoryRowSize < len(memory); row++ {
+		var hexPart, asciiPart strings.Builder
+		for i := row * memoryRowSize; i < (row+1)*memoryRowSize; i++ {
+			if i >= len(memory) {
+				hexPart.WriteString("   ")
+				continue
+			}
+			b := memory[i]
+			char := "."
+			if b >= 0x20 && b < 0x7f {
+				char = string(rune(b))
+			}
+			byteHex := fmt.Sprintf("%02x", b)
+			if i >= len(previous) || previous[i] != b {
+				byteHex, char = changedStyle.Render(byteHex), changedStyle.Render(char)
+			}
+			hexPart.WriteString(byteHex + " ")
+			asciiPart.WriteString(char)
+		}
+		lines = append(lines, fmt.Sprintf("0x%04x: %s %s", row*memoryRowSize, hexPart.String(), asciiPart.String()))
+	}
+	return lines
+}
+
+func (d *debugger) storagePane() []string {
+	slots := d.storage()
+	lines := []string{labelStyle.Render(fmt.Sprintf("Storage (%d slots accessed)", len(slots)))}
+	for _, slot := range slots {
+		access := "read "
+		if slot.Write {
+			access = writeStyle.Render("write")
+		}
+		// a slot and its value don't fit on a line
+		lines = append(lines, fmt.Sprintf("%s %s", access, slot.Slot), "      "+slot.Value)
+	}
+	return lines
+}
+
+func (d *debugger) returnDataPane(op OpCode, width int) []string {
+	lines := []string{labelStyle.Render(fmt.Sprintf("Return data (%d bytes)", len(op.RData)))}
+	if len(op.RData) == 0 {
+		return lines
+	}
+	wrapped := ansi.Hardwrap("0x"+hex.EncodeToString(op.RData), max(1, width), true)
+	return append(lines, strings.Split(wrapped, "\n")...)
+}
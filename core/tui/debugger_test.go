@@ -0,0 +1,69 @@
+package tui
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDebuggerSteps(t *testing.T) {
+	slot := "0x0000000000000000000000000000000000000000000000000000000000000000"
+	word := "0000000000000000000000000000000000000000000000000000000000000001"
+	frame := Node{OpCodes: []OpCode{
+		{OpCode: "SLOAD", Storage: &Storage{Slot: slot, Value: "0x00"}},
+		{OpCode: "SSTORE", Storage: &Storage{Slot: slot, Value: "0x01", Write: true}},
+		{OpCode: "MSTORE"},
+		{OpCode: "STOP", Memory: []string{"0x0000: " + word}},
+	}}
+	d := newDebugger(&frame)
+
+	if slots := d.storage(); len(slots) != 1 || slots[0].Write || slots[0].Value != "0x00" {
+		t.Errorf("storage at the first step: have %+v", slots)
+	}
+	d.move(10)
+	if d.step != 3 {
+		t.Fatalf("stepping past the end: have step %d, want 3", d.step)
+	}
+	if slots := d.storage(); len(slots) != 1 || !slots[0].Write || slots[0].Value != "0x01" {
+		t.Errorf("storage at the last step: have %+v", slots)
+	}
+
+	memory, previous := d.memory()
+	if want := append(bytes.Repeat([]byte{0}, 31), 1); !bytes.Equal(memory, want) || len(previous) != 0 {
+		t.Errorf("memory written by MSTORE: have %x before %x", memory, previous)
+	}
+	// the changed word starts at the first row
+	if d.memoryOffset != 0 {
+		t.Errorf("memory offset: have %d, want 0", d.memoryOffset)
+	}
+	d.scrollMemoryBy(5)
+	if d.memoryOffset != 1 {
+		t.Errorf("memory scrolled past its end: have row %d, want 1", d.memoryOffset)
+	}
+	d.move(-10)
+	if d.step != 0 {
+		t.Errorf("stepping before the start: have step %d, want 0", d.step)
+	}
+}
+
+func TestCallStack(t *testing.T) {
+	step := func(jump, text string) OpCode {
+		return OpCode{Source: &Source{File: "A.sol", Line: 1, Jump: jump, Text: text}}
+	}
+	ops := []OpCode{
+		step("i", "_transfer(from, to, amount);"),
+		step("-", "function _transfer(address from, address to, uint amount) internal {"),
+		step("i", "_update(from, to, amount);"),
+		step("-", "function _update(address from, address to, uint amount) internal virtual {"),
+		step("o", "}"),
+		step("-", "emit Transfer(from, to, amount);"),
+	}
+	if calls := callStack(ops, 1); len(calls) != 1 || calls[0].Function != "_transfer" {
+		t.Errorf("entering _transfer: have %+v", calls)
+	}
+	if calls := callStack(ops, 4); len(calls) != 2 || calls[1].Function != "_update" || calls[1].Caller.Text != "_update(from, to, amount);" {
+		t.Errorf("inside _update: have %+v", calls)
+	}
+	if calls := callStack(ops, 5); len(calls) != 1 {
+		t.Errorf("back in _transfer: have %+v", calls)
+	}
+}
@@ -17,8 +17,87 @@ var FormatedEvent []interface{}
 type Node struct {
 	OnEnter  map[string]interface{} `json:"OnEnter"`
 	Children []Node                 `json:"Children"`
+	Logs     []Log                  `json:"Logs"`
 	OnExit   map[string]interface{} `json:"OnExit"`
-	OpCodes  []interface{}          `json:"OpCodes"`
+	OpCodes  []OpCode               `json:"OpCodes"`
+	Call     *Call                  `json:"Call"`
+	Contract string                 `json:"Contract"`
+}
+
+// OpCode is a step of a frame, with the stack, topmost first, the memory and
+// the return data before it executes.
+type OpCode struct {
+	PC      uint64   `json:"PC"`
+	OpCode  string   `json:"OpCode"`
+	Gas     uint64   `json:"Gas"`
+	Cost    uint64   `json:"Cost"`
+	RData   []byte   `json:"RData"`
+	Depth   int      `json:"Depth"`
+	Stack   []string `json:"Stack"`
+	Memory  []string `json:"Memory"`
+	Storage *Storage `json:"Storage"`
+	Source  *Source  `json:"Source"`
+}
+
+// Storage is the slot read by an SLOAD or written by an SSTORE.
+type Storage struct {
+	Slot  string `json:"Slot"`
+	Value string `json:"Value"`
+	Write bool   `json:"Write"`
+}
+
+// Source is the line of source an opcode was compiled from, Jump being i for
+// a jump into an internal function and o for a jump out of one.
+type Source struct {
+	File   string `json:"File"`
+	Line   int    `json:"Line"`
+	Column int    `json:"Column"`
+	Jump   string `json:"Jump"`
+	Text   string `json:"Text"`
+}
+
+func (s *Source) String() string {
+	if s.Line == 0 {
+		return s.File
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
+}
+
+// Call is the decoded function of a frame, Guessed when it was found from its
+// selector only.
+type Call struct {
+	Name    string `json:"Name"`
+	Args    []Arg  `json:"Args"`
+	Returns []Arg  `json:"Returns"`
+	Guessed bool   `json:"Guessed"`
+}
+
+type Arg struct {
+	Name   string `json:"Name"`
+	Type   string `json:"Type"`
+	Value  string `json:"Value"`
+	Hashed bool   `json:"Hashed"`
+	// Label names an address, or is an amount of a token with its decimals
+	Label string `json:"Label"`
+}
+
+type Log struct {
+	Address     string    `json:"Address"`
+	Topics      []string  `json:"Topics"`
+	Data        string    `json:"Data"`
+	Position    int       `json:"Position"`
+	GlobalIndex int       `json:"GlobalIndex"`
+	Discarded   bool      `json:"Discarded"`
+	Event       *LogEvent `json:"Event"`
+	// AddressLabel names the emitter, empty when it's unknown
+	AddressLabel string `json:"AddressLabel"`
+}
+
+// LogEvent is the decoded event of a log.
+type LogEvent struct {
+	Name    string `json:"Name"`
+	Args    []Arg  `json:"Args"`
+	Guessed bool   `json:"Guessed"`
 }
 
 var (
@@ -29,6 +108,9 @@ var (
 	callStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
 	staticCallStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
 	delegateCallStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	createStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("13"))
+	logStyle          = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+	discardedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Strikethrough(true)
 )
 
 type model struct {
@@ -98,10 +180,23 @@ func max(a, b int) int {
 func DisplayTree(node Node, level int) string {
 	var result string
 	indent := strings.Repeat("  ", level)
+	result += fmt.Sprintf("%s%s\n", indent, frameLine(node))
+
+	// logs are shown between the calls they were emitted around
+	for i, child := range node.Children {
+		result += displayLogs(node.Logs, i, level+1)
+		result += DisplayTree(child, level+1)
+	}
+	result += displayLogs(node.Logs, len(node.Children), level+1)
+
+	return result
+}
 
-	onEnterFrom := node.OnEnter["From"]
-	onEnterTo := node.OnEnter["To"]
-	onEnterType := node.OnEnter["Type"].(string)
+// frameLine renders the call of node on a single line.
+func frameLine(node Node) string {
+	onEnterFrom := addressLabel(node.OnEnter, "From")
+	onEnterTo := addressLabel(node.OnEnter, "To")
+	onEnterType, _ := node.OnEnter["Type"].(string)
 	onEnterValue := node.OnEnter["Value"]
 
 	var onEnterValueStr string
@@ -121,19 +216,87 @@ func DisplayTree(node Node, level int) string {
 		style = staticCallStyle
 	case "DELEGATECALL":
 		style = delegateCallStyle
+	case "CREATE", "CREATE2":
+		style = createStyle
 	default:
 		style = lipgloss.NewStyle()
 	}
 
-	result += fmt.Sprintf("%s%s From: %s To: %s Value: %s -> Output: %s\n", indent, style.Render(onEnterType), onEnterFrom, onEnterTo, onEnterValueStr, onExitOutput)
+	if node.Call != nil {
+		function := fmt.Sprintf("%s(%s)", node.Call.Name, formatArgs(node.Call.Args))
+		if node.Call.Guessed {
+			function += "?"
+		}
+		output := fmt.Sprintf("%v", onExitOutput)
+		if node.Call.Returns != nil {
+			output = "(" + formatArgs(node.Call.Returns) + ")"
+		}
+		return fmt.Sprintf("%s From: %s To: %s Value: %s %s -> %s", style.Render(onEnterType), onEnterFrom, onEnterTo, onEnterValueStr, function, output)
+	}
+	return fmt.Sprintf("%s From: %s To: %s Value: %s -> Output: %s", style.Render(onEnterType), onEnterFrom, onEnterTo, onEnterValueStr, onExitOutput)
+}
 
-	for _, child := range node.Children {
-		result += DisplayTree(child, level+1)
+// addressLabel returns the label of the address of a frame under key, the
+// address itself when it has none.
+func addressLabel(fields map[string]interface{}, key string) interface{} {
+	if label, _ := fields[key+"Label"].(string); label != "" {
+		return label
+	}
+	return fields[key]
+}
+
+func formatArgs(args []Arg) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		value := arg.Value
+		if arg.Label != "" {
+			value = arg.Label
+		}
+		if arg.Hashed {
+			value = "keccak256 " + value
+		}
+		if arg.Name != "" {
+			value = fmt.Sprintf("%s: %s", arg.Name, value)
+		}
+		values[i] = value
 	}
+	return strings.Join(values, ", ")
+}
 
+func displayLogs(logs []Log, position int, level int) string {
+	var result string
+	indent := strings.Repeat("  ", level)
+	for _, log := range logs {
+		if log.Position != position {
+			continue
+		}
+		result += fmt.Sprintf("%s%s\n", indent, logLine(log))
+	}
 	return result
 }
 
+// logLine renders log on a single line, struck through when discarded.
+func logLine(log Log) string {
+	address := log.Address
+	if log.AddressLabel != "" {
+		address = log.AddressLabel
+	}
+	line := fmt.Sprintf("Address: %s Topics: %v Data: 0x%s", address, log.Topics, log.Data)
+	if log.Event != nil {
+		event := fmt.Sprintf("%s(%s)", log.Event.Name, formatArgs(log.Event.Args))
+		if log.Event.Guessed {
+			event += "?"
+		}
+		line = fmt.Sprintf("Address: %s %s", address, event)
+	}
+	if log.Discarded {
+		line = fmt.Sprintf("LOG%d (discarded) %s", len(log.Topics), line)
+		return discardedStyle.Render(line)
+	}
+	line = fmt.Sprintf("LOG%d #%d %s", len(log.Topics), log.GlobalIndex, line)
+	return logStyle.Render(line)
+}
+
 func Display(content string) {
 	m := model{content: content}
 
@@ -0,0 +1,169 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// matches reports whether the frame or the log of n mentions query, which is
+// lowercase: an address or its label, the selector or the decoded name of a
+// function, an event, or an error.
+func (n *treeNode) matches(query string) bool {
+	if query == "" {
+		return false
+	}
+	var fields []string
+	if n.log != nil {
+		fields = append(fields, n.log.Address, n.log.AddressLabel)
+		fields = append(fields, n.log.Topics...)
+		if n.log.Event != nil {
+			fields = append(fields, n.log.Event.Name)
+			fields = append(fields, argLabels(n.log.Event.Args)...)
+		}
+	} else {
+		enter, exit := n.frame.OnEnter, n.frame.OnExit
+		fields = append(fields, fmt.Sprintf("%v", enter["From"]), fmt.Sprintf("%v", enter["To"]), n.frame.Contract)
+		for _, key := range []string{"FromLabel", "ToLabel"} {
+			if label, _ := enter[key].(string); label != "" {
+				fields = append(fields, label)
+			}
+		}
+		if input := fmt.Sprintf("%v", enter["Input"]); len(input) >= 8 {
+			fields = append(fields, "0x"+input[:8])
+		}
+		if n.frame.Call != nil {
+			fields = append(fields, n.frame.Call.Name)
+			fields = append(fields, argLabels(n.frame.Call.Args)...)
+		}
+		if exit != nil {
+			if err, _ := exit["Err"].(string); err != "<nil>" {
+				fields = append(fields, err)
+			}
+			if revert, ok := exit["Revert"].(map[string]interface{}); ok {
+				fields = append(fields, fmt.Sprintf("%v", revert["Reason"]))
+			}
+		}
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// argLabels returns the labels of the addresses passed in args.
+func argLabels(args []Arg) []string {
+	var labels []string
+	for _, arg := range args {
+		if arg.Type == "address" && arg.Label != "" {
+			labels = append(labels, arg.Label)
+		}
+	}
+	return labels
+}
+
+// search sets the query matched by the nodes, an empty one clears the search.
+func (t *tree) search(query string) {
+	t.query = strings.ToLower(strings.TrimSpace(query))
+	t.matches = t.matches[:0]
+	t.kept = make(map[*treeNode]bool)
+	var walk func(nodes []*treeNode) bool
+	walk = func(nodes []*treeNode) bool {
+		found := false
+		for _, n := range nodes {
+			n.match = n.matches(t.query)
+			if n.match {
+				t.matches = append(t.matches, n)
+				t.kept[n] = true
+			}
+			// the frames on the path to a match are kept by the filter
+			if walk(n.children) {
+				t.kept[n] = true
+			}
+			found = found || t.kept[n]
+		}
+		return found
+	}
+	walk(t.roots)
+	if t.filter {
+		t.showMatches()
+	}
+	t.refresh()
+}
+
+// setFilter hides the nodes that neither match nor lead to a match.
+func (t *tree) setFilter(filter bool) {
+	t.filter = filter
+	if filter {
+		t.showMatches()
+	}
+	t.refresh()
+}
+
+// filtering reports whether the rows are filtered, which needs a query.
+func (t *tree) filtering() bool {
+	return t.filter && t.query != ""
+}
+
+// showMatches expands the ancestors of every match.
+func (t *tree) showMatches() {
+	for _, n := range t.matches {
+		for p := n.parent; p != nil; p = p.parent {
+			p.expanded = true
+		}
+	}
+}
+
+// findMatch moves the cursor to the next match in the direction of step,
+// wrapping around, the selected node being a candidate when current is set.
+// It reports whether there was a match.
+func (t *tree) findMatch(step int, current bool) bool {
+	if len(t.matches) == 0 {
+		return false
+	}
+	selected := t.selected()
+	// matches are in the order of the nodes, the selected node is placed
+	// among them
+	position := 0
+	if selected != nil {
+		order := make(map[*treeNode]int)
+		var i int
+		var walk func(nodes []*treeNode)
+		walk = func(nodes []*treeNode) {
+			for _, n := range nodes {
+				order[n] = i
+				i++
+				walk(n.children)
+			}
+		}
+		walk(t.roots)
+		for position < len(t.matches) && order[t.matches[position]] < order[selected] {
+			position++
+		}
+		onMatch := position < len(t.matches) && t.matches[position] == selected
+		switch {
+		case step > 0 && onMatch && !current:
+			position++
+		case step < 0 && (!onMatch || !current):
+			position--
+		}
+	} else if step < 0 {
+		position = len(t.matches) - 1
+	}
+	position = (position + len(t.matches)) % len(t.matches)
+	t.selectNode(t.matches[position])
+	return true
+}
+
+// matchIndex returns the position of the selected node among the matches, -1
+// when it isn't one.
+func (t *tree) matchIndex() int {
+	selected := t.selected()
+	for i, n := range t.matches {
+		if n == selected {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTreeSearch(t *testing.T) {
+	usdc := "0xA0b86991c6218b36c1d19D4a2E9Eb0cE3606eB48"
+	transfer := frame(usdc)
+	transfer.OnEnter["Input"] = "a9059cbb0000"
+	transfer.Call = &Call{Name: "transfer"}
+	reverted := frame("0xcccc")
+	reverted.OnExit = map[string]interface{}{"Err": "execution reverted", "Revert": map[string]interface{}{"Reason": "Ownable: caller is not the owner"}}
+	root := frame("0xaaaa", frame("0xbbbb", frame("0xdddd", transfer)), reverted)
+	root.Logs = []Log{{Address: usdc, Position: 2, Event: &LogEvent{Name: "Transfer"}}}
+	tr := newTree(Event{root})
+
+	to := func() interface{} {
+		if n := tr.selected(); n.frame != nil {
+			return n.frame.OnEnter["To"]
+		}
+		return "log"
+	}
+	for _, query := range []string{"a0b86991", "0xA9059CBB", "transfer", "caller is not the owner"} {
+		tr.search(query)
+		if len(tr.matches) == 0 {
+			t.Errorf("%q: no match", query)
+		}
+	}
+
+	tr.search("usdc_unknown")
+	if tr.findMatch(1, true) {
+		t.Errorf("found a match of an unknown query")
+	}
+
+	// the transfer frame is folded, finding it unfolds its ancestors
+	tr.search(usdc)
+	if len(tr.matches) != 2 {
+		t.Fatalf("have %d matches, want the call and the log", len(tr.matches))
+	}
+	tr.findMatch(1, true)
+	if to() != usdc || tr.matchIndex() != 0 {
+		t.Errorf("first match: have %v", to())
+	}
+	tr.findMatch(1, false)
+	if to() != "log" {
+		t.Errorf("second match: have %v", to())
+	}
+	tr.findMatch(1, false)
+	if to() != usdc {
+		t.Errorf("wrapping around: have %v", to())
+	}
+	tr.findMatch(-1, false)
+	if to() != "log" {
+		t.Errorf("previous match: have %v", to())
+	}
+
+	// the filter keeps the matches and the frames leading to them
+	tr.setFilter(true)
+	var visible []interface{}
+	for tr.top(); ; tr.down() {
+		visible = append(visible, to())
+		if tr.cursor == len(tr.rows)-1 {
+			break
+		}
+	}
+	want := []interface{}{"0xaaaa", "0xbbbb", "0xdddd", usdc, "log"}
+	if len(visible) != len(want) {
+		t.Fatalf("filtered rows: have %v, want %v", visible, want)
+	}
+	for i := range want {
+		if visible[i] != want[i] {
+			t.Errorf("filtered row %d: have %v, want %v", i, visible[i], want[i])
+		}
+	}
+	tr.search("")
+	if len(tr.rows) <= len(want) {
+		t.Errorf("clearing the search kept the filter: %d rows", len(tr.rows))
+	}
+}
+
+func TestTreeSearchLabels(t *testing.T) {
+	usdc := "0xA0b86991c6218b36c1d19D4a2E9Eb0cE3606eB48"
+	transfer := frame(usdc)
+	transfer.OnEnter["ToLabel"] = "USDC"
+	approve := frame("0xbbbb")
+	approve.Call = &Call{Name: "approve", Args: []Arg{{Name: "token", Type: "address", Value: usdc, Label: "USDC"}}}
+	root := frame("0xaaaa", transfer, approve, frame("0xcccc"))
+	root.Logs = []Log{{Address: usdc, AddressLabel: "USDC", Position: 2}}
+	tr := newTree(Event{root})
+
+	tr.search("usdc")
+	if len(tr.matches) != 3 {
+		t.Fatalf("have %d matches, want the call to the token, the call passing it and its log", len(tr.matches))
+	}
+	if line := frameLine(transfer); !strings.Contains(line, "USDC") || strings.Contains(line, usdc) {
+		t.Errorf("frame line shows the address rather than its label: %s", line)
+	}
+}
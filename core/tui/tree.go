@@ -0,0 +1,221 @@
+package tui
+
+// treeNode is a row of the call tree, either a frame or one of the logs of
+// its parent frame.
+type treeNode struct {
+	frame *Node
+	log   *Log
+
+	parent *treeNode
+	// children are the calls and the logs of a frame, in execution order
+	children []*treeNode
+	depth    int
+	expanded bool
+	// match is set when the node matches the search
+	match bool
+}
+
+// tree is the call tree browsed by the viewer, rows are the nodes whose
+// ancestors are all expanded, and which lead to a match of the search when
+// filtering.
+type tree struct {
+	roots  []*treeNode
+	rows   []*treeNode
+	cursor int
+
+	query   string
+	filter  bool
+	matches []*treeNode
+	// kept are the matches and their ancestors
+	kept map[*treeNode]bool
+}
+
+// initialDepth is the number of levels expanded when the trace is opened,
+// the deeper frames are folded to keep large traces readable.
+const initialDepth = 2
+
+func newTree(trace Event) *tree {
+	t := &tree{}
+	for i := range trace {
+		t.roots = append(t.roots, newTreeNode(&trace[i], nil, 0))
+	}
+	t.refresh()
+	return t
+}
+
+func newTreeNode(frame *Node, parent *treeNode, depth int) *treeNode {
+	n := &treeNode{frame: frame, parent: parent, depth: depth, expanded: depth < initialDepth}
+	addLogs := func(position int) {
+		for i := range frame.Logs {
+			if frame.Logs[i].Position == position {
+				n.children = append(n.children, &treeNode{log: &frame.Logs[i], parent: n, depth: depth + 1})
+			}
+		}
+	}
+	// logs are placed between the calls they were emitted around
+	for i := range frame.Children {
+		addLogs(i)
+		n.children = append(n.children, newTreeNode(&frame.Children[i], n, depth+1))
+	}
+	addLogs(len(frame.Children))
+	return n
+}
+
+// refresh rebuilds the visible rows, keeping the cursor on the same node.
+func (t *tree) refresh() {
+	selected := t.selected()
+	t.rows = t.rows[:0]
+	var walk func(nodes []*treeNode)
+	walk = func(nodes []*treeNode) {
+		for _, n := range nodes {
+			if t.filtering() && !t.kept[n] {
+				continue
+			}
+			t.rows = append(t.rows, n)
+			if n.expanded {
+				walk(n.children)
+			}
+		}
+	}
+	walk(t.roots)
+	t.cursor = 0
+	if selected != nil {
+		t.selectNode(selected)
+	}
+}
+
+func (t *tree) selected() *treeNode {
+	if t.cursor < 0 || t.cursor >= len(t.rows) {
+		return nil
+	}
+	return t.rows[t.cursor]
+}
+
+// selectNode moves the cursor to n, expanding its ancestors if needed.
+func (t *tree) selectNode(n *treeNode) {
+	hidden := false
+	for p := n.parent; p != nil; p = p.parent {
+		if !p.expanded {
+			p.expanded, hidden = true, true
+		}
+	}
+	if hidden {
+		t.refresh()
+	}
+	for i, row := range t.rows {
+		if row == n {
+			t.cursor = i
+			return
+		}
+	}
+}
+
+func (t *tree) up() {
+	if t.cursor > 0 {
+		t.cursor--
+	}
+}
+
+func (t *tree) down() {
+	if t.cursor < len(t.rows)-1 {
+		t.cursor++
+	}
+}
+
+func (t *tree) top() {
+	t.cursor = 0
+}
+
+func (t *tree) bottom() {
+	t.cursor = max(0, len(t.rows)-1)
+}
+
+// expand unfolds the selected frame, or moves to its first child if it
+// already is.
+func (t *tree) expand() {
+	n := t.selected()
+	if n == nil || len(n.children) == 0 {
+		return
+	}
+	if n.expanded {
+		t.down()
+		return
+	}
+	n.expanded = true
+	t.refresh()
+}
+
+// collapse folds the selected frame, or moves to its parent if it already is.
+func (t *tree) collapse() {
+	n := t.selected()
+	if n == nil {
+		return
+	}
+	if n.expanded {
+		n.expanded = false
+		t.refresh()
+		return
+	}
+	t.parent()
+}
+
+func (t *tree) toggle() {
+	n := t.selected()
+	if n == nil || len(n.children) == 0 {
+		return
+	}
+	n.expanded = !n.expanded
+	t.refresh()
+}
+
+func (t *tree) parent() {
+	if n := t.selected(); n != nil && n.parent != nil {
+		t.selectNode(n.parent)
+	}
+}
+
+// sibling moves the cursor by step among the nodes sharing the parent of the
+// selected one.
+func (t *tree) sibling(step int) {
+	n := t.selected()
+	if n == nil {
+		return
+	}
+	siblings := t.roots
+	if n.parent != nil {
+		siblings = n.parent.children
+	}
+	for i, s := range siblings {
+		if s == n {
+			if j := i + step; j >= 0 && j < len(siblings) {
+				t.selectNode(siblings[j])
+			}
+			return
+		}
+	}
+}
+
+// setExpanded folds or unfolds every frame.
+func (t *tree) setExpanded(expanded bool) {
+	var walk func(nodes []*treeNode)
+	walk = func(nodes []*treeNode) {
+		for _, n := range nodes {
+			if len(n.children) > 0 {
+				n.expanded = expanded
+				walk(n.children)
+			}
+		}
+	}
+	walk(t.roots)
+	// the selection can't stay inside a folded frame
+	if n := t.selected(); n != nil && !expanded {
+		for n.parent != nil {
+			n = n.parent
+		}
+		t.rows, t.cursor = t.rows[:0], 0
+		t.refresh()
+		t.selectNode(n)
+		return
+	}
+	t.refresh()
+}
@@ -0,0 +1,58 @@
+package tui
+
+import "testing"
+
+func frame(to string, children ...Node) Node {
+	return Node{OnEnter: map[string]interface{}{"Type": "CALL", "To": to}, Children: children}
+}
+
+func TestTreeNavigation(t *testing.T) {
+	root := frame("a", frame("b", frame("c", frame("d"))), frame("e"))
+	root.Logs = []Log{{Address: "a", Position: 1}}
+	tr := newTree(Event{root})
+
+	// the levels below the initial depth are folded: a, b, c, log, e
+	if len(tr.rows) != 5 {
+		t.Fatalf("have %d visible rows, want 5", len(tr.rows))
+	}
+	to := func() interface{} {
+		if n := tr.selected(); n.frame != nil {
+			return n.frame.OnEnter["To"]
+		}
+		return "log"
+	}
+
+	tr.down()
+	tr.sibling(1)
+	if to() != "log" {
+		t.Errorf("next sibling of b: have %v", to())
+	}
+	tr.sibling(1)
+	tr.parent()
+	if to() != "a" {
+		t.Errorf("parent of e: have %v", to())
+	}
+
+	tr.bottom()
+	tr.up()
+	tr.up()
+	tr.expand()
+	tr.expand()
+	if to() != "d" {
+		t.Errorf("expanding c twice: have %v", to())
+	}
+	tr.collapse()
+	tr.collapse()
+	if to() != "c" || tr.selected().expanded {
+		t.Errorf("collapsing d twice: have %v", to())
+	}
+
+	tr.setExpanded(false)
+	if len(tr.rows) != 1 || to() != "a" {
+		t.Errorf("collapse all: have %d rows on %v", len(tr.rows), to())
+	}
+	tr.setExpanded(true)
+	if len(tr.rows) != 6 {
+		t.Errorf("expand all: have %d rows", len(tr.rows))
+	}
+}